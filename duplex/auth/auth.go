@@ -0,0 +1,166 @@
+// Package auth implements session authentication schemes for rpc.Server and
+// talk.Peer. Each scheme is a pair of an rpc.Authenticator, set on the Server
+// of the responding side, and rpc.Credentials, passed to rpc.Authenticate or
+// Peer.Authenticate on the calling side. For other schemes, use
+// rpc.AuthenticatorFunc and rpc.CredentialsFunc.
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// ErrInvalidToken is returned when a token is not accepted.
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// Token returns Credentials that send a bearer token.
+func Token(token string) rpc.Credentials {
+	return rpc.CredentialsFunc(func(ctx context.Context, ex rpc.Exchange) error {
+		return ex.Send(token)
+	})
+}
+
+// TokenAuthenticator returns an Authenticator that receives a bearer token and
+// uses validate to check it and return the identity of the caller.
+func TokenAuthenticator(validate func(ctx context.Context, token string) (identity any, err error)) rpc.Authenticator {
+	return rpc.AuthenticatorFunc(func(ctx context.Context, ex rpc.Exchange) (any, error) {
+		var token string
+		if err := ex.Receive(&token); err != nil {
+			return nil, err
+		}
+		return validate(ctx, token)
+	})
+}
+
+// StaticTokens returns an Authenticator that accepts the tokens in the map,
+// using their values as the identity of the caller.
+func StaticTokens(tokens map[string]any) rpc.Authenticator {
+	return TokenAuthenticator(func(ctx context.Context, token string) (any, error) {
+		for t, identity := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return identity, nil
+			}
+		}
+		return nil, ErrInvalidToken
+	})
+}
+
+// challengeSize is the size of the random challenge and nonce
+// signed with ed25519 keys.
+const challengeSize = 32
+
+// signaturePrefix separates signatures made by Ed25519 Credentials from
+// signatures the same key makes for anything else.
+const signaturePrefix = "duplex-auth-v1\x00"
+
+type signedChallenge struct {
+	PublicKey []byte
+	Nonce     []byte
+	Signature []byte
+}
+
+type bindingKey struct{}
+
+// WithBinding returns a copy of ctx with a value identifying the session being
+// authenticated, which Ed25519 Credentials sign along with the challenge, and
+// Ed25519Authenticator expects them to have signed. Both sides must use the same
+// binding, such as keying material exported from the TLS connection the session
+// is made over, so a signature can't be relayed to authenticate another session.
+// The Credentials get it from the context passed to rpc.Authenticate, and the
+// Authenticator from the context passed to rpc.Server.Respond.
+func WithBinding(ctx context.Context, binding []byte) context.Context {
+	return context.WithValue(ctx, bindingKey{}, binding)
+}
+
+func bindingFrom(ctx context.Context) []byte {
+	b, _ := ctx.Value(bindingKey{}).([]byte)
+	return b
+}
+
+// signedMessage returns the message signed with key for challenge, which
+// is the signature prefix followed by the challenge, the nonce of the
+// Credentials, the public key and the session binding.
+func signedMessage(challenge, nonce []byte, key ed25519.PublicKey, binding []byte) []byte {
+	msg := make([]byte, 0, len(signaturePrefix)+len(challenge)+len(nonce)+len(key)+len(binding))
+	msg = append(msg, signaturePrefix...)
+	msg = append(msg, challenge...)
+	msg = append(msg, nonce...)
+	msg = append(msg, key...)
+	return append(msg, binding...)
+}
+
+// Ed25519 returns Credentials that prove possession of key by signing a
+// random challenge sent by an Ed25519Authenticator, along with a nonce of
+// their own and the session binding set with WithBinding, if any.
+func Ed25519(key ed25519.PrivateKey) rpc.Credentials {
+	return rpc.CredentialsFunc(func(ctx context.Context, ex rpc.Exchange) error {
+		var challenge []byte
+		if err := ex.Receive(&challenge); err != nil {
+			return err
+		}
+		if len(challenge) != challengeSize {
+			return fmt.Errorf("auth: unexpected challenge size %d", len(challenge))
+		}
+		nonce := make([]byte, challengeSize)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		pub := key.Public().(ed25519.PublicKey)
+		return ex.Send(signedChallenge{
+			PublicKey: pub,
+			Nonce:     nonce,
+			Signature: ed25519.Sign(key, signedMessage(challenge, nonce, pub, bindingFrom(ctx))),
+		})
+	})
+}
+
+// Ed25519Authenticator returns an Authenticator that sends a random challenge to
+// be signed by Ed25519 Credentials. Once the signature is verified, authorize is
+// used to check the public key and return the identity of the caller. Signatures
+// must be made with the session binding set with WithBinding, if any.
+func Ed25519Authenticator(authorize func(ctx context.Context, key ed25519.PublicKey) (identity any, err error)) rpc.Authenticator {
+	return rpc.AuthenticatorFunc(func(ctx context.Context, ex rpc.Exchange) (any, error) {
+		challenge := make([]byte, challengeSize)
+		if _, err := rand.Read(challenge); err != nil {
+			return nil, err
+		}
+		if err := ex.Send(challenge); err != nil {
+			return nil, err
+		}
+		var signed signedChallenge
+		if err := ex.Receive(&signed); err != nil {
+			return nil, err
+		}
+		if len(signed.PublicKey) != ed25519.PublicKeySize {
+			return nil, errors.New("auth: invalid public key")
+		}
+		if len(signed.Nonce) != challengeSize {
+			return nil, errors.New("auth: invalid nonce")
+		}
+		key := ed25519.PublicKey(signed.PublicKey)
+		msg := signedMessage(challenge, signed.Nonce, key, bindingFrom(ctx))
+		if !ed25519.Verify(key, msg, signed.Signature) {
+			return nil, errors.New("auth: invalid signature")
+		}
+		return authorize(ctx, key)
+	})
+}
+
+// AuthorizedKeys returns an authorize function for Ed25519Authenticator that
+// accepts the given keys, using the key as the identity of the caller.
+func AuthorizedKeys(keys ...ed25519.PublicKey) func(context.Context, ed25519.PublicKey) (any, error) {
+	return func(ctx context.Context, key ed25519.PublicKey) (any, error) {
+		for _, k := range keys {
+			if k.Equal(key) {
+				return key, nil
+			}
+		}
+		return nil, errors.New("auth: unauthorized key")
+	}
+}
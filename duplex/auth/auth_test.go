@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/talk"
+)
+
+func fatal(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newPeers(authenticator rpc.Authenticator) (server, client *talk.Peer) {
+	return newBoundPeers(authenticator, nil)
+}
+
+// newBoundPeers returns peers like newPeers, with the server
+// authenticating with binding set with WithBinding.
+func newBoundPeers(authenticator rpc.Authenticator, binding []byte) (server, client *talk.Peer) {
+	a, b := mux.Pair()
+	server = talk.NewPeer(a, codec.CBORCodec{})
+	server.Server.Authenticator = authenticator
+	server.Handle("whoami", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		r.Return(c.Identity())
+	}))
+	go server.Server.Respond(a, WithBinding(context.Background(), binding))
+	client = talk.NewPeer(b, codec.CBORCodec{})
+	return
+}
+
+func TestToken(t *testing.T) {
+	ctx := context.Background()
+	authenticator := StaticTokens(map[string]any{"s3cret": "alice"})
+
+	t.Run("valid", func(t *testing.T) {
+		server, client := newPeers(authenticator)
+		defer server.Close()
+
+		fatal(t, client.Authenticate(ctx, Token("s3cret")))
+		var identity string
+		_, err := client.Call(ctx, "whoami", nil, &identity)
+		fatal(t, err)
+		if identity != "alice" {
+			t.Fatalf("unexpected identity: %v", identity)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		server, client := newPeers(authenticator)
+		defer server.Close()
+
+		err := client.Authenticate(ctx, Token("guess"))
+		if !errors.Is(err, rpc.ErrUnauthenticated) {
+			t.Fatalf("expected unauthenticated error: %v", err)
+		}
+	})
+}
+
+func TestEd25519(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	fatal(t, err)
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	fatal(t, err)
+	authenticator := Ed25519Authenticator(AuthorizedKeys(pub))
+
+	t.Run("authorized", func(t *testing.T) {
+		server, client := newPeers(authenticator)
+		defer server.Close()
+
+		fatal(t, client.Authenticate(ctx, Ed25519(priv)))
+		var identity []byte
+		_, err := client.Call(ctx, "whoami", nil, &identity)
+		fatal(t, err)
+		if !pub.Equal(ed25519.PublicKey(identity)) {
+			t.Fatalf("unexpected identity: %v", identity)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server, client := newPeers(authenticator)
+		defer server.Close()
+
+		err := client.Authenticate(ctx, Ed25519(otherPriv))
+		if !errors.Is(err, rpc.ErrUnauthenticated) {
+			t.Fatalf("expected unauthenticated error: %v", err)
+		}
+	})
+	t.Run("raw challenge signature", func(t *testing.T) {
+		server, client := newPeers(authenticator)
+		defer server.Close()
+
+		err := client.Authenticate(ctx, rpc.CredentialsFunc(func(ctx context.Context, ex rpc.Exchange) error {
+			var challenge []byte
+			if err := ex.Receive(&challenge); err != nil {
+				return err
+			}
+			return ex.Send(signedChallenge{
+				PublicKey: pub,
+				Nonce:     make([]byte, challengeSize),
+				Signature: ed25519.Sign(priv, challenge),
+			})
+		}))
+		if !errors.Is(err, rpc.ErrUnauthenticated) {
+			t.Fatalf("expected unauthenticated error: %v", err)
+		}
+	})
+
+	t.Run("session binding", func(t *testing.T) {
+		server, client := newBoundPeers(authenticator, []byte("session-a"))
+		defer server.Close()
+
+		fatal(t, client.Authenticate(WithBinding(ctx, []byte("session-a")), Ed25519(priv)))
+	})
+
+	t.Run("other session binding", func(t *testing.T) {
+		server, client := newBoundPeers(authenticator, []byte("session-a"))
+		defer server.Close()
+
+		err := client.Authenticate(WithBinding(ctx, []byte("session-b")), Ed25519(priv))
+		if !errors.Is(err, rpc.ErrUnauthenticated) {
+			t.Fatalf("expected unauthenticated error: %v", err)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -24,7 +23,7 @@ import (
 var benchCmd = &cli.Command{
 	Usage: "bench",
 	Short: "interop benchmark",
-	Run: func(ctx context.Context, args []string) {
+	Run: func(ctx *cli.Context, args []string) {
 		log.SetOutput(os.Stderr)
 
 		var c codec.Codec = codec.CBORCodec{}
@@ -50,26 +49,8 @@ var benchCmd = &cli.Command{
 		}
 
 		if cmd != nil {
-			cmd.Stderr = os.Stderr
-			wc, err := cmd.StdinPipe()
-			if err != nil {
-				fatal(err)
-			}
-			rc, err := cmd.StdoutPipe()
-			if err != nil {
-				fatal(err)
-			}
-			sess, err = mux.DialIO(wc, rc)
-			if err != nil {
-				fatal(err)
-			}
-			if err := cmd.Start(); err != nil {
-				fatal(err)
-			}
-			defer func() {
-				cmd.Process.Signal(os.Interrupt)
-				cmd.Wait()
-			}()
+			sess, err = mux.DialCommand(cmd)
+			fatal(err)
 		} else {
 			// check against remote quic endpoint
 			sess, err = quic.Dial(strings.TrimPrefix(args[0], "udp://"), false)
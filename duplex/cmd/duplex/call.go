@@ -18,7 +18,7 @@ var callCmd = &cli.Command{
 	Usage: "call",
 	Short: "call a remote function",
 	Args:  cli.MinArgs(1),
-	Run: func(ctx context.Context, args []string) {
+	Run: func(ctx *cli.Context, args []string) {
 		log.SetOutput(os.Stderr)
 		u, err := url.Parse(args[0])
 		if err != nil {
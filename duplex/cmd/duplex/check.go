@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
@@ -33,7 +32,7 @@ var vals = []any{
 var checkCmd = &cli.Command{
 	Usage: "check",
 	Short: "check interop",
-	Run: func(ctx context.Context, args []string) {
+	Run: func(ctx *cli.Context, args []string) {
 		log.SetOutput(os.Stderr)
 
 		var c codec.Codec = codec.CBORCodec{}
@@ -63,26 +62,8 @@ var checkCmd = &cli.Command{
 		}
 
 		if cmd != nil {
-			cmd.Stderr = os.Stderr
-			wc, err := cmd.StdinPipe()
-			if err != nil {
-				fatal(err)
-			}
-			rc, err := cmd.StdoutPipe()
-			if err != nil {
-				fatal(err)
-			}
-			sess, err = mux.DialIO(wc, rc)
-			if err != nil {
-				fatal(err)
-			}
-			if err := cmd.Start(); err != nil {
-				fatal(err)
-			}
-			defer func() {
-				cmd.Process.Signal(os.Interrupt)
-				cmd.Wait()
-			}()
+			sess, err = mux.DialCommand(cmd)
+			fatal(err)
 		} else {
 			switch u.Scheme {
 			case "udp":
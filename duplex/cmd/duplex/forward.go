@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+
+	"tractor.dev/toolkit-go/duplex/auth"
+	"tractor.dev/toolkit-go/duplex/forward"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/talk"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+// tokenEnv names the environment variable with the token
+// peers authenticate with to forward ports.
+const tokenEnv = "DUPLEX_TOKEN"
+
+var forwardAllow []forward.Addr
+
+var forwardCmd = &cli.Command{
+	Usage: "forward",
+	Short: "forward ports over a duplex peer",
+}
+
+var forwardServeCmd = &cli.Command{
+	Usage: "serve <url>",
+	Short: "accept peers and serve forwarding requests",
+	Long: `serve accepts peers at url and serves their forwarding requests, which makes
+connections from this host. So it refuses to start unless peers have to authenticate
+with the token in $DUPLEX_TOKEN, or -allow limits the addresses they can dial and
+listen on, or both. Addresses are given as "host:port" or "unix:/path", and -allow
+can be repeated. A tcp or ws url without a host listens on the loopback interface.
+The local and remote commands authenticate with $DUPLEX_TOKEN when it is set.`,
+	Args: cli.ExactArgs(1),
+	Run: func(ctx *cli.Context, args []string) {
+		log.SetOutput(os.Stderr)
+		token := os.Getenv(tokenEnv)
+		if token == "" && len(forwardAllow) == 0 {
+			fatal(fmt.Errorf("refusing to serve without $%s or -allow", tokenEnv))
+		}
+		u, err := url.Parse(args[0])
+		fatal(err)
+
+		var l mux.Listener
+		switch u.Scheme {
+		case "tcp":
+			l, err = mux.ListenTCP(loopbackDefault(u.Host))
+		case "unix":
+			l, err = mux.ListenUnix(u.Path)
+		case "ws":
+			l, err = mux.ListenWS(loopbackDefault(u.Host))
+		default:
+			err = errors.New("unsupported protocol")
+		}
+		fatal(err)
+		defer l.Close()
+
+		c := peerCodec()
+		log.Printf("* Listening on %s...\n", l.Addr())
+		for {
+			sess, err := l.Accept()
+			fatal(err)
+			peer := talk.NewPeer(sess, c)
+			if token != "" {
+				peer.Server.Authenticator = auth.StaticTokens(map[string]any{token: "peer"})
+			}
+			f := forward.Register(peer)
+			if len(forwardAllow) > 0 {
+				f.Dial = allowedDial
+				f.Listen = allowedListen
+			}
+			go peer.Respond()
+		}
+	},
+}
+
+// loopbackDefault returns hostport with the loopback address
+// as the host if it has none.
+func loopbackDefault(hostport string) string {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil || host != "" {
+		return hostport
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// allowed returns an error unless the address is allowed with -allow.
+func allowed(network, address string) error {
+	for _, a := range forwardAllow {
+		if a.Network == network && a.Address == address {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s:%s is not allowed", rpc.ErrPermissionDenied, network, address)
+}
+
+func allowedDial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := allowed(network, address); err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func allowedListen(network, address string) (net.Listener, error) {
+	if err := allowed(network, address); err != nil {
+		return nil, err
+	}
+	return net.Listen(network, address)
+}
+
+var forwardLocalCmd = &cli.Command{
+	Usage: "local <url> <listen-addr> <target-addr>",
+	Short: "listen locally and connect to target from the peer",
+	Args:  cli.ExactArgs(3),
+	Run: func(ctx *cli.Context, args []string) {
+		log.SetOutput(os.Stderr)
+		peer, f := dialForward(ctx, args[0])
+		defer peer.Close()
+
+		addr := forward.ParseAddr(args[1])
+		l, err := net.Listen(addr.Network, addr.Address)
+		fatal(err)
+		log.Printf("* Forwarding %s to %s on peer...\n", l.Addr(), args[2])
+		fatal(f.Local(ctx, l, forward.ParseAddr(args[2])))
+	},
+}
+
+var forwardRemoteCmd = &cli.Command{
+	Usage: "remote <url> <listen-addr> <target-addr>",
+	Short: "listen on the peer and connect to target locally",
+	Args:  cli.ExactArgs(3),
+	Run: func(ctx *cli.Context, args []string) {
+		log.SetOutput(os.Stderr)
+		peer, f := dialForward(ctx, args[0])
+		defer peer.Close()
+
+		bound, err := f.Remote(ctx, forward.ParseAddr(args[1]), forward.ParseAddr(args[2]))
+		fatal(err)
+		log.Printf("* Forwarding %s on peer to %s...\n", bound, args[2])
+		peer.Session.Wait()
+	},
+}
+
+func init() {
+	forwardServeCmd.Flags().Func("allow", "address peers can dial or listen on", func(s string) error {
+		forwardAllow = append(forwardAllow, forward.ParseAddr(s))
+		return nil
+	})
+	forwardCmd.AddCommand(forwardServeCmd)
+	forwardCmd.AddCommand(forwardLocalCmd)
+	forwardCmd.AddCommand(forwardRemoteCmd)
+}
+
+func dialForward(ctx context.Context, addr string) (*talk.Peer, *forward.Forwarder) {
+	peer := dialPeer(addr)
+	f := forward.Register(peer)
+	go peer.Respond()
+	if token := os.Getenv(tokenEnv); token != "" {
+		fatal(peer.Authenticate(ctx, auth.Token(token)))
+	}
+	return peer, f
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tractor.dev/toolkit-go/duplex/gen"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+var genOutput string
+
+var genCmd = &cli.Command{
+	Usage: "gen <dir> <interface>...",
+	Short: "generate typed clients and servers for Go interfaces",
+	Long: `gen generates a typed client and server adapter for each of the named interfaces
+in the Go package in dir. The generated code uses the same conventions as fn.HandlerFrom
+and fn.ClientFor, so it interoperates with peers using them. The output is written to
+<interface>_duplex.go in dir, using the first interface name, unless -o is used.`,
+	Args: cli.MinArgs(2),
+	Run: func(ctx *cli.Context, args []string) {
+		log.SetOutput(os.Stderr)
+		src, err := gen.Generate(args[0], args[1:]...)
+		fatal(err)
+
+		out := genOutput
+		if out == "" {
+			out = filepath.Join(args[0], strings.ToLower(args[1])+"_duplex.go")
+		}
+		fatal(os.WriteFile(out, src, 0644))
+	},
+}
+
+func init() {
+	genCmd.Flags().StringVar(&genOutput, "o", "", "output file")
+}
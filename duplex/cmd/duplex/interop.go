@@ -24,7 +24,7 @@ var interopCmd = &cli.Command{
 	Usage: "interop",
 	Short: "run interop service",
 	Args:  cli.MaxArgs(1),
-	Run: func(ctx context.Context, args []string) {
+	Run: func(ctx *cli.Context, args []string) {
 		log.SetOutput(os.Stderr)
 
 		var c codec.Codec = codec.CBORCodec{}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+var lsCmd = &cli.Command{
+	Usage: "ls",
+	Short: "list selectors served by a remote peer",
+	Long:  "ls lists the selectors of a peer serving the rpc.introspect selector, set up with rpc.Introspect.",
+	Args:  cli.ExactArgs(1),
+	Run: func(ctx *cli.Context, args []string) {
+		log.SetOutput(os.Stderr)
+		peer := dialPeer(args[0])
+		defer peer.Close()
+
+		var infos []rpc.SelectorInfo
+		_, err := peer.Call(context.Background(), rpc.IntrospectSelector, nil, &infos)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, info := range infos {
+			if info.Params == nil && info.Returns == nil {
+				fmt.Println(info.Selector)
+				continue
+			}
+			fmt.Printf("%s(%s) (%s)\n", info.Selector, strings.Join(info.Params, ", "), strings.Join(info.Returns, ", "))
+		}
+	},
+}
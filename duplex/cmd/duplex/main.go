@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"log"
+	"net/url"
 	"os"
 
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/talk"
 	"tractor.dev/toolkit-go/engine/cli"
 )
 
@@ -18,6 +21,10 @@ func main() {
 	root.AddCommand(interopCmd)
 	root.AddCommand(checkCmd)
 	root.AddCommand(benchCmd)
+	root.AddCommand(forwardCmd)
+	root.AddCommand(lsCmd)
+	root.AddCommand(genCmd)
+	root.AddCommand(schemaCmd)
 
 	if err := cli.Execute(context.Background(), root, os.Args[1:]); err != nil {
 		fatal(err)
@@ -29,3 +36,27 @@ func fatal(err error) {
 		log.Fatal(err)
 	}
 }
+
+// peerCodec returns the codec used with peers, which is CBOR
+// unless QTALK_CODEC is set to "json".
+func peerCodec() codec.Codec {
+	if os.Getenv("QTALK_CODEC") == "json" {
+		log.Println("* Using JSON codec")
+		return codec.JSONCodec{}
+	}
+	return codec.CBORCodec{}
+}
+
+// dialPeer dials the peer at a URL such as tcp://host:port or unix:///path,
+// using the talk transport named by the scheme.
+func dialPeer(addr string) *talk.Peer {
+	u, err := url.Parse(addr)
+	fatal(err)
+	host := u.Host
+	if u.Scheme == "unix" {
+		host = u.Path
+	}
+	peer, err := talk.Dial(u.Scheme, host, peerCodec())
+	fatal(err)
+	return peer
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"tractor.dev/toolkit-go/duplex/fn"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+var schemaCmd = &cli.Command{
+	Usage: "schema",
+	Short: "print the OpenRPC schema of a remote peer",
+	Long:  "schema prints the OpenRPC document of a peer serving the rpc.schema selector, set up with fn.ServeSchema.",
+	Args:  cli.ExactArgs(1),
+	Run: func(ctx *cli.Context, args []string) {
+		log.SetOutput(os.Stderr)
+		peer := dialPeer(args[0])
+		defer peer.Close()
+
+		var doc fn.Document
+		_, err := peer.Call(context.Background(), fn.SchemaSelector, nil, &doc)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -1,10 +1,16 @@
 package fn
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
+	"tractor.dev/toolkit-go/duplex/rpc"
 )
 
 var errorInterface = reflect.TypeOf((*error)(nil)).Elem()
@@ -21,50 +27,213 @@ func Call(fn any, args []any) (_ []any, err error) {
 	if err != nil {
 		return nil, err
 	}
-	fnReturn := fnval.Call(fnParams)
+	var fnReturn []reflect.Value
+	if fnval.Type().IsVariadic() {
+		fnReturn = fnval.CallSlice(fnParams)
+	} else {
+		fnReturn = fnval.Call(fnParams)
+	}
 	return ParseReturn(fnReturn)
 }
 
 // ArgsTo converts the arguments into `reflect.Value`s suitable to pass as
 // parameters to a function with the given type via reflection.
+//
+// Arguments are decoded into the parameter types using mapstructure, with decode
+// hooks for values as they arrive from codecs: numbers into any integer type as
+// long as they fit without losing precision, RFC 3339 strings or Unix seconds
+// into time.Time, and base64 strings into []byte. Struct fields are decoded the
+// way encoding/json does, using json tags and promoting fields of embedded structs,
+// as every decode path does. Earlier versions used mapstructure tags instead, which
+// are now ignored, so structs tagged for mapstructure need json tags.
+// Arguments already assignable to the parameter type are used as is, and nil
+// becomes the zero value.
+//
+// For variadic functions, the variadic arguments can either be given as
+// separate trailing arguments or as a single slice, and the last value
+// returned is a slice to pass with reflect.Value.CallSlice.
 func ArgsTo(fntyp reflect.Type, args []any) ([]reflect.Value, error) {
-	if len(args) != fntyp.NumIn() {
-		return nil, fmt.Errorf("fn: expected %d params, got %d", fntyp.NumIn(), len(args))
+	numIn := fntyp.NumIn()
+	if fntyp.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("fn: expected at least %d params, got %d", numIn-1, len(args))
+		}
+		if len(args) != numIn || !isList(args[numIn-1]) {
+			// collect trailing variadic arguments into a single slice argument
+			variadic := append([]any{}, args[numIn-1:]...)
+			args = append(args[:numIn-1:numIn-1], variadic)
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("fn: expected %d params, got %d", numIn, len(args))
 	}
 	fnParams := make([]reflect.Value, len(args))
-	for idx, param := range args {
-		switch fntyp.In(idx).Kind() {
-		case reflect.Struct:
-			// decode to struct type using mapstructure
-			arg := reflect.New(fntyp.In(idx))
-			if err := mapstructure.Decode(param, arg.Interface()); err != nil {
-				return nil, fmt.Errorf("fn: mapstructure: %s", err.Error())
+	for idx, arg := range args {
+		v, err := decodeArg(arg, fntyp.In(idx))
+		if err != nil {
+			return nil, fmt.Errorf("fn: param %d: expected %s: %s", idx, fntyp.In(idx), err)
+		}
+		fnParams[idx] = v
+	}
+	return fnParams, nil
+}
+
+func isList(v any) bool {
+	if v == nil {
+		return false
+	}
+	k := reflect.TypeOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// decodeArg decodes arg into a value of type t.
+func decodeArg(arg any, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(t), nil
+	}
+	if rv := reflect.ValueOf(arg); rv.Type().AssignableTo(t) {
+		v := reflect.New(t).Elem()
+		v.Set(rv)
+		return v, nil
+	}
+	ptr := reflect.New(t)
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(intHook, timeHook, bytesHook),
+		TagName:    "json",
+		Squash:     true,
+		Result:     ptr.Interface(),
+	})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if err := dec.Decode(arg); err != nil {
+		return reflect.Value{}, decodeError(err)
+	}
+	return ptr.Elem(), nil
+}
+
+// decodeError simplifies the messages of mapstructure errors,
+// which name fields the top level value doesn't have.
+func decodeError(err error) error {
+	msgs := []string{err.Error()}
+	var merr *mapstructure.Error
+	if errors.As(err, &merr) {
+		msgs = merr.Errors
+	}
+	for i, msg := range msgs {
+		msg = strings.TrimPrefix(msg, "error decoding '': ")
+		msg = strings.TrimPrefix(msg, "'' ")
+		msgs[i] = msg
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// intHook checks numbers decoded into integer types are whole and fit.
+func intHook(from, to reflect.Type, data any) (any, error) {
+	v := reflect.ValueOf(data)
+	switch to.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch from.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return nil, fmt.Errorf("%v is not a valid %s", f, to)
 			}
-			fnParams[idx] = ensureType(arg.Elem(), fntyp.In(idx))
-		case reflect.Slice:
-			rv := reflect.ValueOf(param)
-			// decode slice of structs to struct type using mapstructure
-			if fntyp.In(idx).Elem().Kind() == reflect.Struct {
-				nv := reflect.MakeSlice(fntyp.In(idx), rv.Len(), rv.Len())
-				for i := 0; i < rv.Len(); i++ {
-					ref := reflect.New(nv.Index(i).Type())
-					if err := mapstructure.Decode(rv.Index(i).Interface(), ref.Interface()); err != nil {
-						return nil, fmt.Errorf("fn: mapstructure: %s", err.Error())
-					}
-					nv.Index(i).Set(reflect.Indirect(ref))
-				}
-				rv = nv
+			i = int64(f)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.Uint() > math.MaxInt64 {
+				return nil, fmt.Errorf("%v overflows %s", v.Uint(), to)
 			}
-			fnParams[idx] = rv
+			i = int64(v.Uint())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = v.Int()
 		default:
-			// if int is expected but got float64 assume json-like encoding and cast float to int
-			if fntyp.In(idx).Kind() == reflect.Int && reflect.TypeOf(param).Kind() == reflect.Float64 {
-				param = int(param.(float64))
+			return data, nil
+		}
+		if reflect.Zero(to).OverflowInt(i) {
+			return nil, fmt.Errorf("%v overflows %s", i, to)
+		}
+		return i, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch from.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return nil, fmt.Errorf("%v is not a valid %s", f, to)
+			}
+			u = uint64(f)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 {
+				return nil, fmt.Errorf("%v overflows %s", v.Int(), to)
 			}
-			fnParams[idx] = ensureType(reflect.ValueOf(param), fntyp.In(idx))
+			u = uint64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u = v.Uint()
+		default:
+			return data, nil
+		}
+		if reflect.Zero(to).OverflowUint(u) {
+			return nil, fmt.Errorf("%v overflows %s", u, to)
 		}
+		return u, nil
 	}
-	return fnParams, nil
+	return data, nil
+}
+
+// timeHook decodes RFC 3339 strings, as time.Time is encoded by JSON,
+// and Unix seconds, as it is encoded by CBOR, into time.Time.
+func timeHook(from, to reflect.Type, data any) (any, error) {
+	if to != timeType {
+		return data, nil
+	}
+	v := reflect.ValueOf(data)
+	switch from.Kind() {
+	case reflect.String:
+		return time.Parse(time.RFC3339Nano, v.String())
+	case reflect.Float32, reflect.Float64:
+		sec, frac := math.Modf(v.Float())
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return time.Unix(v.Int(), 0), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return time.Unix(int64(v.Uint()), 0), nil
+	}
+	return data, nil
+}
+
+// bytesHook decodes base64 strings, as []byte is encoded by JSON, into []byte.
+func bytesHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Slice || to.Elem().Kind() != reflect.Uint8 {
+		return data, nil
+	}
+	return base64.StdEncoding.DecodeString(reflect.ValueOf(data).String())
+}
+
+// DecodeArgs receives the Args of a call and converts them the same way
+// HandlerFrom handlers do, storing them in the values pointed to by ptrs.
+// If variadic is true, the last pointer is to the slice of variadic arguments
+// of the method, which can be given as separate trailing arguments as with
+// ArgsTo. It is used by handlers generated with "duplex gen".
+func DecodeArgs(c *rpc.Call, variadic bool, ptrs ...any) error {
+	var args []any
+	if err := c.Receive(&args); err != nil {
+		return fmt.Errorf("fn: args: %s", err.Error())
+	}
+	in := make([]reflect.Type, len(ptrs))
+	for i, ptr := range ptrs {
+		in[i] = reflect.TypeOf(ptr).Elem()
+	}
+	params, err := ArgsTo(reflect.FuncOf(in, nil, variadic), args)
+	if err != nil {
+		return err
+	}
+	for i, ptr := range ptrs {
+		reflect.ValueOf(ptr).Elem().Set(params[i])
+	}
+	return nil
 }
 
 // ParseReturn splits the results of reflect.Call() into the values, and
@@ -89,35 +258,3 @@ func ParseReturn(ret []reflect.Value) ([]any, error) {
 	}
 	return out, nil
 }
-
-// ensureType ensures a value is converted to the expected
-// defined type from a convertable underlying type
-func ensureType(v reflect.Value, t reflect.Type) reflect.Value {
-	if !v.IsValid() {
-		// handle nil values with zero value of expected type
-		return reflect.New(t).Elem()
-	}
-	nv := v
-	if v.Type().Kind() == reflect.Slice && v.Type().Elem() != t {
-		switch t.Kind() {
-		case reflect.Array:
-			nv = reflect.Indirect(reflect.New(t))
-			for i := 0; i < v.Len(); i++ {
-				vv := reflect.ValueOf(v.Index(i).Interface())
-				nv.Index(i).Set(vv.Convert(nv.Type().Elem()))
-			}
-		case reflect.Slice:
-			nv = reflect.MakeSlice(t, 0, 0)
-			for i := 0; i < v.Len(); i++ {
-				vv := reflect.ValueOf(v.Index(i).Interface())
-				nv = reflect.Append(nv, vv.Convert(nv.Type().Elem()))
-			}
-		default:
-			panic("unable to convert slice to non-array, non-slice type")
-		}
-	}
-	if v.Type() != t {
-		nv = nv.Convert(t)
-	}
-	return nv
-}
@@ -1,9 +1,15 @@
 package fn
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/rpc/rpctest"
 )
 
 func fatal(err error, t *testing.T) {
@@ -62,6 +68,149 @@ func TestCallArgStructSlice(t *testing.T) {
 	}
 }
 
+func TestArgsTo(t *testing.T) {
+	type point struct{ X, Y int }
+	type tagged struct {
+		Name string `json:"name" mapstructure:"full_name"`
+		Nick string `mapstructure:"nick_name"`
+	}
+	when := time.Date(2023, 10, 1, 12, 30, 0, 500, time.UTC)
+
+	tests := []struct {
+		name     string
+		fn       any
+		args     []any
+		expected []any
+	}{
+		{
+			"map of structs", func(m map[string]point) map[string]point { return m },
+			[]any{map[string]any{"a": map[string]any{"X": 1.0, "Y": 2.0}}},
+			[]any{map[string]point{"a": {1, 2}}},
+		},
+		{
+			"pointer to struct", func(p *point) *point { return p },
+			[]any{map[string]any{"X": 1.0}},
+			[]any{&point{X: 1}},
+		},
+		{
+			"nil pointer to struct", func(p *point) *point { return p },
+			[]any{nil},
+			[]any{(*point)(nil)},
+		},
+		{
+			"json tags over mapstructure tags", func(v tagged) tagged { return v },
+			[]any{map[string]any{"name": "a", "full_name": "b", "nick_name": "c"}},
+			[]any{tagged{Name: "a"}},
+		},
+		{
+			"time from string", func(t time.Time) time.Time { return t },
+			[]any{when.Format(time.RFC3339Nano)},
+			[]any{when},
+		},
+		{
+			"time from unix seconds", func(t time.Time) int64 { return t.Unix() },
+			[]any{uint64(when.Unix())},
+			[]any{when.Unix()},
+		},
+		{
+			"bytes from base64", func(b []byte) string { return string(b) },
+			[]any{"aGVsbG8="},
+			[]any{"hello"},
+		},
+		{
+			"sized and unsigned ints from floats", func(a uint8, b int16, c uint64) int { return int(a) + int(b) + int(c) },
+			[]any{255.0, -300.0, 45.0},
+			[]any{0},
+		},
+		{
+			"array from slice", func(a [2]int) int { return a[0] + a[1] },
+			[]any{[]any{1.0, 2.0}},
+			[]any{3},
+		},
+		{
+			"variadic args", func(sep string, s ...string) string { return strings.Join(s, sep) },
+			[]any{"-", "a", "b"},
+			[]any{"a-b"},
+		},
+		{
+			"variadic slice", func(sep string, s ...string) string { return strings.Join(s, sep) },
+			[]any{"-", []any{"a", "b"}},
+			[]any{"a-b"},
+		},
+		{
+			"variadic none", func(sep string, s ...string) int { return len(s) },
+			[]any{"-"},
+			[]any{0},
+		},
+	}
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			actual, err := Call(td.fn, td.args)
+			fatal(err, t)
+			if !reflect.DeepEqual(td.expected, actual) {
+				t.Errorf("expected: %#v\ngot: %#v", td.expected, actual)
+			}
+		})
+	}
+
+	errTests := []struct {
+		name string
+		fn   any
+		args []any
+		err  string
+	}{
+		{"wrong type", func(a int, b string) {}, []any{1, 2}, "fn: param 1: expected string"},
+		{"fractional int", func(a int) {}, []any{1.5}, "fn: param 0: expected int: 1.5 is not a valid int"},
+		{"int overflow", func(a int8) {}, []any{300.0}, "fn: param 0: expected int8: 300 overflows int8"},
+		{"negative uint", func(a uint) {}, []any{-1}, "fn: param 0: expected uint: -1 overflows uint"},
+		{"bad time", func(t time.Time) {}, []any{"yesterday"}, "fn: param 0: expected time.Time"},
+		{"bad struct field", func(p point) {}, []any{map[string]any{"X": "one"}}, "fn: param 0: expected fn.point"},
+		{"slice to non-slice", func(a int) {}, []any{[]any{1}}, "fn: param 0: expected int"},
+		{"too few variadic", func(a int, b ...int) {}, nil, "fn: expected at least 1 params, got 0"},
+	}
+	for _, td := range errTests {
+		t.Run(td.name, func(t *testing.T) {
+			_, err := Call(td.fn, td.args)
+			if err == nil || !strings.HasPrefix(err.Error(), td.err) {
+				t.Fatalf("expected error starting with %q, got: %v", td.err, err)
+			}
+		})
+	}
+}
+
+func TestArgsToCodecs(t *testing.T) {
+	type arg struct {
+		When  time.Time
+		Data  []byte
+		Count uint16
+		Tags  map[string]*subfake
+	}
+	in := arg{
+		When:  time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC),
+		Data:  []byte("hello"),
+		Count: 42,
+		Tags:  map[string]*subfake{"a": {A: "b"}},
+	}
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			client, _ := rpctest.NewPair(HandlerFrom(func(a arg, when time.Time, data []byte, n int8) (arg, error) {
+				if !a.When.Equal(when) || string(data) != string(a.Data) || n != -1 {
+					return a, fmt.Errorf("unexpected args: %v %v %v", when, data, n)
+				}
+				return a, nil
+			}), cd)
+			defer client.Close()
+
+			var out arg
+			_, err := client.Call(context.Background(), "", Args{in, in.When, in.Data, -1}, &out)
+			fatal(err, t)
+			if !out.When.Equal(in.When) || string(out.Data) != "hello" || out.Count != 42 || out.Tags["a"].A != "b" {
+				t.Fatalf("unexpected return: %#v", out)
+			}
+		})
+	}
+}
+
 func TestParseReturn(t *testing.T) {
 	tests := []struct {
 		name        string
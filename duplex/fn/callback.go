@@ -0,0 +1,101 @@
+package fn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"reflect"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// CallbackPrefix is the selector prefix callbacks are registered under
+// on the calling side.
+const CallbackPrefix = "fn.callback"
+
+// Callback is the reference a function argument is sent as by a Caller made
+// with WithCallbacks. Handlers made with HandlerFrom receive it in function
+// parameters as a function that calls the selector back on the calling side.
+type Callback struct {
+	Selector string `json:"$fn"`
+}
+
+var callbackType = reflect.TypeOf(Callback{})
+
+// WithCallbacks returns a Caller that makes calls with caller, sending function
+// values in Args as Callbacks. Each function is registered on m, which must be
+// the handler responding to calls on the same session, for as long as the call
+// takes to return. Functions are made into handlers with HandlerFrom, unless
+// they are rpc.HandlerFunc values.
+//
+//	peer := talk.NewPeer(sess, codec)
+//	go peer.Respond()
+//	caller := fn.WithCallbacks(peer, peer.RespondMux)
+//	caller.Call(ctx, "watch", fn.Args{"path", func(event string) {
+//		log.Println(event)
+//	}})
+//
+// ClientFor and ClientWith can be used with the returned Caller to pass
+// function arguments to handler functions that take function parameters.
+func WithCallbacks(caller rpc.Caller, m *rpc.RespondMux) rpc.Caller {
+	return rpc.CallerFunc(func(ctx context.Context, selector string, params any, reply ...any) (*rpc.Response, error) {
+		args, ok := params.(Args)
+		if !ok {
+			return caller.Call(ctx, selector, params, reply...)
+		}
+		var copied bool
+		var callbacks []string
+		defer func() {
+			for _, sel := range callbacks {
+				m.Remove(sel)
+			}
+		}()
+		for i, arg := range args {
+			v := reflect.ValueOf(arg)
+			if v.Kind() != reflect.Func {
+				continue
+			}
+			if !copied {
+				// copy so the caller's Args are left unchanged
+				args = append(Args(nil), args...)
+				copied = true
+			}
+			if v.IsNil() {
+				args[i] = nil
+				continue
+			}
+			h, ok := arg.(rpc.Handler)
+			if !ok {
+				h = fromFunc(v, Options{})
+			}
+			id, err := NewID()
+			if err != nil {
+				return nil, err
+			}
+			sel := CallbackPrefix + "." + id
+			m.Handle(sel, h)
+			callbacks = append(callbacks, sel)
+			args[i] = Callback{Selector: sel}
+		}
+		return caller.Call(ctx, selector, args, reply...)
+	})
+}
+
+// callbackFunc returns a function of type fntyp that calls the Callback cb
+// with caller, or a nil function if cb has no selector.
+func callbackFunc(caller rpc.Caller, cb Callback, fntyp reflect.Type) reflect.Value {
+	if cb.Selector == "" {
+		return reflect.Zero(fntyp)
+	}
+	return makeStub(caller, cb.Selector, fntyp)
+}
+
+// NewID returns a random ID for the selector of a handler registered for
+// the remote side of a session, so it can't call handlers it wasn't sent.
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
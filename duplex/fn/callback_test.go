@@ -0,0 +1,120 @@
+package fn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+type callbackService struct{}
+
+func (callbackService) Each(items []string, fn func(i int, item string)) int {
+	for i, item := range items {
+		fn(i, item)
+	}
+	return len(items)
+}
+
+func (callbackService) Map(ctx context.Context, s string, fn func(ctx context.Context, s string) (string, error)) (string, error) {
+	return fn(ctx, s)
+}
+
+func (callbackService) Maybe(fn func() string) string {
+	if fn == nil {
+		return "nil"
+	}
+	return fn()
+}
+
+// newCallbackPair returns a client for handler that also responds
+// to calls back from it with m.
+func newCallbackPair(handler rpc.Handler, m *rpc.RespondMux, cd codec.Codec) *rpc.Client {
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	sessA, _ := mux.DialIO(aw, ar)
+	sessB, _ := mux.DialIO(bw, br)
+
+	srv := &rpc.Server{Codec: cd, Handler: handler}
+	go srv.Respond(sessA, nil)
+	back := &rpc.Server{Codec: cd, Handler: m}
+	go back.Respond(sessB, nil)
+
+	return rpc.NewClient(sessB, cd)
+}
+
+func TestCallbacks(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			ctx := context.Background()
+			m := rpc.NewRespondMux()
+			client := newCallbackPair(HandlerFrom(callbackService{}), m, cd)
+			defer client.Close()
+			caller := WithCallbacks(client, m)
+
+			t.Run("call", func(t *testing.T) {
+				var got []string
+				var n int
+				_, err := caller.Call(ctx, "Each", Args{[]string{"a", "b"}, func(i int, item string) {
+					got = append(got, fmt.Sprintf("%d:%s", i, item))
+				}}, &n)
+				fatal(err, t)
+				if n != 2 || strings.Join(got, ",") != "0:a,1:b" {
+					t.Fatalf("unexpected callbacks: %v %v", n, got)
+				}
+				if len(m.Selectors()) != 0 {
+					t.Fatalf("expected callbacks to be removed: %v", m.Selectors())
+				}
+			})
+
+			t.Run("client", func(t *testing.T) {
+				c := ClientFor[struct {
+					Map   func(ctx context.Context, s string, fn func(ctx context.Context, s string) (string, error)) (string, error)
+					Maybe func(fn func() string) (string, error)
+				}](caller, "")
+				s, err := c.Map(ctx, "abc", func(ctx context.Context, s string) (string, error) {
+					return strings.ToUpper(s), nil
+				})
+				fatal(err, t)
+				if s != "ABC" {
+					t.Fatalf("unexpected return: %v", s)
+				}
+
+				_, err = c.Map(ctx, "abc", func(ctx context.Context, s string) (string, error) {
+					return "", fmt.Errorf("failed")
+				})
+				if err == nil || !strings.Contains(err.Error(), "failed") {
+					t.Fatalf("expected callback error, got: %v", err)
+				}
+
+				s, err = c.Maybe(nil)
+				fatal(err, t)
+				if s != "nil" {
+					t.Fatalf("unexpected return: %v", s)
+				}
+				s, err = c.Maybe(func() string { return "called" })
+				fatal(err, t)
+				if s != "called" {
+					t.Fatalf("unexpected return: %v", s)
+				}
+			})
+
+			t.Run("handler func", func(t *testing.T) {
+				var got string
+				_, err := caller.Call(ctx, "Maybe", Args{rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+					c.Receive(nil)
+					r.Return("handled")
+				})}, &got)
+				fatal(err, t)
+				if got != "handled" {
+					t.Fatalf("unexpected return: %v", got)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package fn
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+var clientConstructors sync.Map // reflect.Type => func(rpc.Caller, string) any
+
+// RegisterClient registers a constructor used by ClientFor to make clients
+// for the interface type T. Go reflection is unable to implement interfaces,
+// so code generated by "duplex gen" uses this to make ClientFor work with
+// interfaces.
+func RegisterClient[T any](newClient func(caller rpc.Caller, prefix string) T) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	clientConstructors.Store(t, func(caller rpc.Caller, prefix string) any {
+		return newClient(caller, prefix)
+	})
+}
+
+// ClientFor returns a client for handlers made with HandlerFrom, mounted
+// at prefix, that makes calls with caller. It is the mirror image of
+// HandlerFrom, so a prefix of "" calls selectors named after the methods.
+//
+// T can be a struct with func fields, which are set to functions making
+// calls to the selector of the field name:
+//
+//	type Calculator struct {
+//		Add func(ctx context.Context, a, b int) (int, error)
+//	}
+//	calc := ClientFor[Calculator](peer, "calc")
+//	sum, err := calc.Add(ctx, 2, 3) // calls "calc.Add"
+//
+// A leading context.Context parameter is used as the context of the call and
+// the other parameters are sent as Args. Returned values are decoded into the
+// non-error return types. If the last return is an error, call errors are
+// returned with it, otherwise the function panics with them.
+//
+// T should be a struct of func fields. Go reflection cannot make a value that
+// implements an interface, so ClientFor cannot make clients for interfaces by
+// itself. If T is an interface, a client for it must be registered with
+// RegisterClient, such as by code generated by "duplex gen", or ClientFor panics.
+func ClientFor[T any](caller rpc.Caller, prefix string) T {
+	return ClientWith[T](caller, prefix, Options{})
+}
+
+// ClientWith is ClientFor using options to match handlers made with HandlerWith.
+// Naming is used for the selector names of func fields, and with Nested, struct
+// and struct pointer fields are set to clients mounted under their name. Clients
+// for interfaces are made with the registered constructor, which ignores options.
+func ClientWith[T any](caller rpc.Caller, prefix string, opts Options) T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	switch t.Kind() {
+	case reflect.Interface:
+		newClient, ok := clientConstructors.Load(t)
+		if !ok {
+			panic(fmt.Sprintf("fn: no client registered for interface %s, use RegisterClient or a struct of func fields", t))
+		}
+		return newClient.(func(rpc.Caller, string) any)(caller, prefix).(T)
+	case reflect.Struct:
+		return makeClient(caller, prefix, t, opts, map[reflect.Type]bool{}).Interface().(T)
+	default:
+		panic("must be struct or interface")
+	}
+}
+
+// makeClient returns a value of the struct type t with func fields set to stubs.
+// Pointer fields to types already being made are left nil.
+func makeClient(caller rpc.Caller, prefix string, t reflect.Type, opts Options, making map[reflect.Type]bool) reflect.Value {
+	making[t] = true
+	defer delete(making, t)
+	v := reflect.New(t).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		selector := joinSelector(prefix, opts.name(field.Name))
+		switch {
+		case field.Type.Kind() == reflect.Func:
+			v.Field(i).Set(makeStub(caller, selector, field.Type))
+		case opts.Nested && field.Type.Kind() == reflect.Struct:
+			v.Field(i).Set(makeClient(caller, selector, field.Type, opts, making))
+		case opts.Nested && field.Type.Kind() == reflect.Pointer && field.Type.Elem().Kind() == reflect.Struct && !making[field.Type.Elem()]:
+			v.Field(i).Set(makeClient(caller, selector, field.Type.Elem(), opts, making).Addr())
+		}
+	}
+	return v
+}
+
+func joinSelector(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// makeStub returns a function of type fntyp that calls selector with caller.
+func makeStub(caller rpc.Caller, selector string, fntyp reflect.Type) reflect.Value {
+	returnsErr := fntyp.NumOut() > 0 && fntyp.Out(fntyp.NumOut()-1) == errorInterface
+	return reflect.MakeFunc(fntyp, func(in []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if len(in) > 0 && fntyp.In(0) == contextType {
+			if c, ok := in[0].Interface().(context.Context); ok && c != nil {
+				ctx = c
+			}
+			in = in[1:]
+		}
+		args := make(Args, len(in))
+		for i, v := range in {
+			args[i] = v.Interface()
+		}
+
+		out := make([]reflect.Value, fntyp.NumOut())
+		var replies []any
+		for i := range out {
+			if returnsErr && i == len(out)-1 {
+				out[i] = reflect.Zero(errorInterface)
+				continue
+			}
+			ptr := reflect.New(fntyp.Out(i))
+			out[i] = ptr.Elem()
+			replies = append(replies, ptr.Interface())
+		}
+
+		_, err := caller.Call(ctx, selector, args, replies...)
+		if err != nil {
+			if !returnsErr {
+				panic(err)
+			}
+			for i := range out {
+				out[i] = reflect.Zero(fntyp.Out(i))
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+		}
+		return out
+	})
+}
@@ -0,0 +1,118 @@
+package fn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/rpc/rpctest"
+)
+
+type calcService struct{}
+
+func (calcService) Add(a, b int) int {
+	return a + b
+}
+
+func (calcService) Div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, fmt.Errorf("divide by zero: %w", rpc.ErrInvalidArgument)
+	}
+	return a / b, nil
+}
+
+func (calcService) Split(s fake) (subfake, int) {
+	return s.A, s.B
+}
+
+func (calcService) Reset() {}
+
+type calcClient struct {
+	Add   func(a, b int) int
+	Div   func(ctx context.Context, a, b int) (int, error)
+	Split func(s fake) (subfake, int)
+	Reset func(ctx context.Context) error
+
+	unexported func()
+}
+
+type calcInterface interface {
+	Add(a, b int) int
+}
+
+// unregisteredCalc is never registered with RegisterClient, unlike calcInterface,
+// which stays registered once a test registers it.
+type unregisteredCalc interface {
+	Add(a, b int) int
+}
+
+type calcInterfaceClient struct {
+	calcClient
+}
+
+func (c calcInterfaceClient) Add(a, b int) int {
+	return c.calcClient.Add(a, b)
+}
+
+func TestClientFor(t *testing.T) {
+	m := rpc.NewRespondMux()
+	m.Handle("calc", HandlerFrom(calcService{}))
+
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			client, _ := rpctest.NewPair(m, cd)
+			defer client.Close()
+
+			calc := ClientFor[calcClient](client, "calc")
+			if sum := calc.Add(2, 3); sum != 5 {
+				t.Fatalf("unexpected sum: %v", sum)
+			}
+
+			q, err := calc.Div(context.Background(), 6, 3)
+			if err != nil || q != 2 {
+				t.Fatalf("unexpected div: %v %v", q, err)
+			}
+			_, err = calc.Div(context.Background(), 1, 0)
+			if !errors.Is(err, rpc.ErrInvalidArgument) {
+				t.Fatalf("expected invalid argument: %v", err)
+			}
+
+			sub, n := calc.Split(fake{A: subfake{A: "Hello"}, B: 42})
+			if sub.A != "Hello" || n != 42 {
+				t.Fatalf("unexpected split: %v %v", sub, n)
+			}
+
+			if err := calc.Reset(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("interface", func(t *testing.T) {
+		client, _ := rpctest.NewPair(m, codec.JSONCodec{})
+		defer client.Close()
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected panic for unregistered interface")
+			}
+		}()
+		ClientFor[unregisteredCalc](client, "calc")
+	})
+
+	t.Run("registered interface", func(t *testing.T) {
+		client, _ := rpctest.NewPair(m, codec.JSONCodec{})
+		defer client.Close()
+
+		RegisterClient(func(caller rpc.Caller, prefix string) calcInterface {
+			return calcInterfaceClient{ClientFor[calcClient](caller, prefix)}
+		})
+		calc := ClientFor[calcInterface](client, "calc")
+		if sum := calc.Add(2, 3); sum != 5 {
+			t.Fatalf("unexpected sum: %v", sum)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package fn
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -34,13 +35,45 @@ import (
 // error is returned. Handlers based on functions that return more than two values will
 // simply ignore the remaining values.
 //
+// Functions can also take a leading context.Context argument, which is given the
+// context of the call. Like the Call pointer argument, it is not part of the
+// argument array.
+//
+// Function parameters are given functions that call back the caller, which
+// sends function arguments as Callbacks using a Caller made with WithCallbacks.
+// Calls to them fail once the call to the handler returns.
+//
+// Functions can also take a final channel argument for streaming. A receive-only
+// channel gets the values the caller sends after the arguments, until the caller
+// ends the stream, as done by SendStream. Values sent on any other channel are
+// streamed back to the caller over a continued response, as are values sent on
+// a channel returned as the first value, which can be received with ReceiveStream.
+// The stream ends once the function closes the channel. A function taking a channel
+// argument runs while its values are streamed, and the response is continued as soon
+// as it sends a value, closes the channel or returns. Its return values are only sent
+// if it returns first, and an error it returns later ends the stream with the error.
+//
 // Structs that implement the Handler interface will be added as a catch-all handler
 // along with their individual methods. This lets you implement dynamic methods.
 func HandlerFrom[T any](v T) rpc.Handler {
+	return HandlerWith[T](v, Options{})
+}
+
+// HandlerWith is HandlerFrom using options to name, exclude and nest handlers
+// registered for the methods of a struct:
+//
+//	h := HandlerWith(svc, Options{
+//		Naming:  SnakeCase,
+//		Exclude: []string{"Close"},
+//		Nested:  true,
+//	})
+//
+// With Nested, a Users field with a Get method is registered at "users.get".
+func HandlerWith[T any](v T, opts Options) rpc.Handler {
 	rv := reflect.Indirect(reflect.ValueOf(v))
 	switch rv.Type().Kind() {
 	case reflect.Func:
-		return fromFunc(reflect.ValueOf(v))
+		return fromFunc(reflect.ValueOf(v), opts)
 	case reflect.Struct:
 		// assume T is an interface
 		t := reflect.TypeOf((*T)(nil)).Elem()
@@ -49,7 +82,7 @@ func HandlerFrom[T any](v T) rpc.Handler {
 			// so then just use TypeOf v
 			t = reflect.TypeOf(v)
 		}
-		return fromMethods(v, t)
+		return fromMethods(v, t, opts, "", map[any]bool{})
 	default:
 		panic("must be func or struct")
 	}
@@ -62,21 +95,46 @@ type Args []any
 
 var handlerFuncType = reflect.TypeOf((*rpc.HandlerFunc)(nil)).Elem()
 
-func fromMethods(rcvr interface{}, t reflect.Type) rpc.Handler {
+func fromMethods(rcvr interface{}, t reflect.Type, opts Options, path string, seen map[any]bool) rpc.Handler {
 	// If `t` is an interface, `Convert()` wraps the value with that interface
 	// type. This makes sure that the Method(i) indexes match for getting both the
 	// name and implementation.
 	rcvrval := reflect.ValueOf(rcvr).Convert(t)
+	if rcvrval.Kind() == reflect.Pointer {
+		seen[rcvrval.Pointer()] = true
+	}
 	mux := rpc.NewRespondMux()
 	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		if opts.excluded(path+name, name) {
+			continue
+		}
 		m := rcvrval.Method(i)
 		var h rpc.Handler
-		if m.CanConvert(handlerFuncType) {
+		switch {
+		case m.CanConvert(handlerFuncType):
 			h = m.Convert(handlerFuncType).Interface().(rpc.HandlerFunc)
-		} else {
-			h = fromFunc(m)
+		case opts.Nested && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 && isStruct(m.Type().Out(0)):
+			h = fromNested(m.Call(nil)[0], opts, path+name+".", seen)
+			if h == nil {
+				continue
+			}
+		default:
+			h = fromFunc(m, opts)
+		}
+		mux.Handle(opts.name(name), h)
+	}
+	// fields are only mounted when methods are not limited by an interface
+	if rv := reflect.Indirect(rcvrval); opts.Nested && t == reflect.TypeOf(rcvr) && rv.Kind() == reflect.Struct {
+		for i := 0; i < rv.NumField(); i++ {
+			field := rv.Type().Field(i)
+			if !field.IsExported() || field.Anonymous || opts.excluded(path+field.Name, field.Name) {
+				continue
+			}
+			if h := fromNested(rv.Field(i), opts, path+field.Name+".", seen); h != nil {
+				mux.Handle(opts.name(field.Name), h)
+			}
 		}
-		mux.Handle(t.Method(i).Name, h)
 	}
 	h, ok := rcvr.(rpc.Handler)
 	if ok {
@@ -85,27 +143,115 @@ func fromMethods(rcvr interface{}, t reflect.Type) rpc.Handler {
 	return mux
 }
 
+// fromNested returns a sub handler for the value of a field or method, or nil
+// if there is none because it is nil, already mounted or has nothing to register.
+// Pointers are mounted once, and struct values are not mounted within a value of
+// the same type, so methods returning their own type don't recurse forever.
+func fromNested(v reflect.Value, opts Options, path string, seen map[any]bool) rpc.Handler {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.Kind() == reflect.Struct && v.CanAddr() {
+		// include methods with pointer receivers
+		v = v.Addr()
+	}
+	if v.Kind() == reflect.Pointer && seen[v.Pointer()] {
+		return nil
+	}
+	if v.Kind() == reflect.Struct {
+		if seen[v.Type()] {
+			return nil
+		}
+		seen[v.Type()] = true
+		defer delete(seen, v.Type())
+	}
+	if h, ok := v.Interface().(rpc.Handler); ok {
+		return h
+	}
+	if !isStruct(v.Type()) {
+		return nil
+	}
+	sub := fromMethods(v.Interface(), v.Type(), opts, path, seen).(*rpc.RespondMux)
+	if len(sub.Selectors()) == 0 {
+		return nil
+	}
+	return sub
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
 var callRef = reflect.TypeOf((*rpc.Call)(nil))
 
-func fromFunc(fn reflect.Value) rpc.Handler {
+// streamBuffer is the buffer size of channels made for channel parameters.
+const streamBuffer = 512
+
+func fromFunc(fn reflect.Value, opts Options) rpc.Handler {
 	fntyp := fn.Type()
 	// if the last argument in fn is an rpc.Call, add our call to fnParams
 	expectsCallParam := fntyp.NumIn() > 0 && fntyp.In(fntyp.NumIn()-1) == callRef
+	// if the first argument in fn is a context, add the call context to fnParams
+	expectsCtxParam := fntyp.NumIn() > 0 && fntyp.In(0) == contextType
+
+	// if the last arg in fn is a channel, we'll make a channel to either stream
+	// values from the caller if it is receive-only, or stream back otherwise
+	var chanParam reflect.Type
+	if fntyp.NumIn() > 0 && fntyp.In(fntyp.NumIn()-1).Kind() == reflect.Chan {
+		chanParam = fntyp.In(fntyp.NumIn() - 1)
+	}
+	recvStream := chanParam != nil && chanParam.ChanDir() == reflect.RecvDir
+
+	// if the first return in fn is a channel, we'll stream back its values
+	chanReturn := fntyp.NumOut() > 0 && fntyp.Out(0).Kind() == reflect.Chan
+	// otherwise values sent on a channel param are streamed back while fn runs
+	sendStream := chanParam != nil && !recvStream && !chanReturn
+
+	// the type of a function taking just the arguments sent by the caller
+	var argTypes []reflect.Type
+	for i := 0; i < fntyp.NumIn(); i++ {
+		argTypes = append(argTypes, fntyp.In(i))
+	}
+	if expectsCallParam || chanParam != nil {
+		argTypes = argTypes[:len(argTypes)-1]
+	}
+	if expectsCtxParam {
+		argTypes = argTypes[1:]
+	}
+	argsTyp := reflect.FuncOf(argTypes, nil, fntyp.IsVariadic())
 
-	// if the last arg or first return in fn is a channel, we'll make a channel to stream back
-	expectsChanParam := fntyp.NumIn() > 0 && fntyp.In(fntyp.NumIn()-1).Kind() == reflect.Chan
-	var chanType reflect.Type
-	var chanStream bool
-	if expectsChanParam {
-		chanType = fntyp.In(fntyp.NumIn() - 1)
-		chanStream = true
+	// function parameters are sent as Callbacks, so decode them as such
+	decodeTyp := argsTyp
+	var funcParams []int
+	for i, t := range argTypes {
+		if t.Kind() == reflect.Func && !(fntyp.IsVariadic() && i == len(argTypes)-1) {
+			funcParams = append(funcParams, i)
+		}
 	}
-	if fntyp.NumOut() > 0 && fntyp.Out(0).Kind() == reflect.Chan {
-		chanType = fntyp.Out(0)
-		chanStream = true
+	if len(funcParams) > 0 {
+		decodeTypes := append([]reflect.Type(nil), argTypes...)
+		for _, i := range funcParams {
+			decodeTypes[i] = callbackType
+		}
+		decodeTyp = reflect.FuncOf(decodeTypes, nil, fntyp.IsVariadic())
 	}
 
-	return rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+	var validate func(args []any) error
+	if opts.Validate {
+		g := &schemaGen{defs: map[string]*Schema{}}
+		params := g.params(argsTyp)
+		v := &validator{defs: g.defs}
+		validate = func(args []any) error {
+			return v.validateArgs(params, argsTyp.IsVariadic(), args)
+		}
+	}
+
+	return &funcHandler{typ: fntyp, args: argsTyp, HandlerFunc: func(r rpc.Responder, c *rpc.Call) {
 		var params []any
 
 		defer func() {
@@ -114,47 +260,267 @@ func fromFunc(fn reflect.Value) rpc.Handler {
 			}
 		}()
 
-		var ch any
 		if err := c.Receive(&params); err != nil {
 			r.Return(fmt.Errorf("fn: args: %s", err.Error()))
 			return
 		}
-		if expectsCallParam {
-			params = append(params, c)
-		} else if expectsChanParam {
-			// TODO: somehow pass buffer via CallHeader?
-			_ = chanType
-			//ch = reflect.MakeChan(chanType, 512).Interface() // not supported by tinygo 0.28.1
-			//params = append(params, ch)
-		}
-		ret, err := Call(fn.Interface(), params)
+		if validate != nil {
+			if err := validate(params); err != nil {
+				r.Return(err)
+				return
+			}
+		}
+		fnParams, err := ArgsTo(decodeTyp, params)
 		if err != nil {
 			r.Return(err)
 			return
 		}
-		if chanStream && fntyp.NumOut() > 0 && fntyp.Out(0).Kind() == reflect.Chan {
-			ch = ret[0]
-			ret = ret[1:]
+		for _, i := range funcParams {
+			fnParams[i] = callbackFunc(c.Caller, fnParams[i].Interface().(Callback), argTypes[i])
+		}
+		if expectsCtxParam {
+			ctx := c.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			fnParams = append([]reflect.Value{reflect.ValueOf(ctx)}, fnParams...)
+		}
+		var ch reflect.Value
+		if expectsCallParam {
+			fnParams = append(fnParams, reflect.ValueOf(c))
+		} else if chanParam != nil {
+			ch = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, chanParam.Elem()), streamBuffer)
+			if recvStream {
+				done := make(chan struct{})
+				defer close(done)
+				go receiveValues(c, ch, done)
+			}
+			fnParams = append(fnParams, ch.Convert(chanParam))
+		}
+		call := func() []reflect.Value {
+			if fntyp.IsVariadic() {
+				return fn.CallSlice(fnParams)
+			}
+			return fn.Call(fnParams)
 		}
-		if chanStream {
-			c, _ := r.Continue(ret...)
-			go streamValues(r, c, reflect.ValueOf(ch))
+		if sendStream {
+			returned := make(chan funcReturn, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						returned <- funcReturn{err: fmt.Errorf("panic: %s [%s] %s(%s)", p, identifyPanic(), c.Selector(), params)}
+					}
+				}()
+				ret, err := ParseReturn(call())
+				returned <- funcReturn{ret, err}
+			}()
+			streamReturn(r, ch, returned)
+			return
+		}
+		ret, err := ParseReturn(call())
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		if chanReturn {
+			ch = reflect.ValueOf(ret[0])
+			c, err := r.Continue(ret[1:]...)
+			if err != nil {
+				// the caller won't get the stream, so just keep
+				// the function from blocking on sending
+				go drainValues(ch)
+				return
+			}
+			go streamValues(r, c, ch)
 			return
 		}
 		r.Return(ret...)
+	}}
+}
+
+// funcHandler is a handler for a function that implements rpc.Describer
+// using the function signature.
+type funcHandler struct {
+	rpc.HandlerFunc
+	typ  reflect.Type
+	args reflect.Type // function type of the arguments sent by callers
+}
+
+// returns returns the types of the values returned to callers,
+// leaving out a final error and a streamed channel.
+func (h *funcHandler) returns() []reflect.Type {
+	var types []reflect.Type
+	for i := 0; i < h.typ.NumOut(); i++ {
+		out := h.typ.Out(i)
+		if (i == 0 && out.Kind() == reflect.Chan) || (i == h.typ.NumOut()-1 && out == errorInterface) {
+			continue
+		}
+		types = append(types, out)
+	}
+	return types
+}
+
+// Describe returns the parameter and return types of the function,
+// leaving out a leading context and a final Call pointer parameter.
+func (h *funcHandler) Describe() (params, returns []string) {
+	for i := 0; i < h.typ.NumIn(); i++ {
+		in := h.typ.In(i)
+		if in == callRef || (i == 0 && in == contextType) {
+			continue
+		}
+		if h.typ.IsVariadic() && i == h.typ.NumIn()-1 {
+			params = append(params, "..."+in.Elem().String())
+			continue
+		}
+		params = append(params, in.String())
+	}
+	for i := 0; i < h.typ.NumOut(); i++ {
+		returns = append(returns, h.typ.Out(i).String())
+	}
+	return
+}
+
+// funcReturn is what a function called in its own goroutine returned.
+type funcReturn struct {
+	values []any
+	err    error
+}
+
+// streamReturn streams the values sent on the reflected Go channel by a function
+// running in its own goroutine, continuing the response as soon as the function
+// sends a value, closes the channel or returns. If it returns first, its values
+// are returned with the continued response, or its error is returned instead.
+// Otherwise the response is continued without values, and an error it returns
+// ends the stream.
+func streamReturn(r rpc.Responder, valueCh reflect.Value, returned <-chan funcReturn) {
+	chosen, v, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: valueCh},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(returned)},
 	})
+	if chosen == 1 {
+		ret := v.Interface().(funcReturn)
+		if ret.err != nil {
+			go drainValues(valueCh)
+			r.Return(ret.err)
+			return
+		}
+		ch, err := r.Continue(ret.values...)
+		if err != nil {
+			go drainValues(valueCh)
+			return
+		}
+		go streamValues(r, ch, valueCh)
+		return
+	}
+	ch, err := r.Continue()
+	if err != nil {
+		if ok {
+			go drainValues(valueCh)
+		}
+		return
+	}
+	if !ok {
+		v = reflect.Value{}
+	}
+	go streamUntilReturn(r, ch, valueCh, v, returned)
+}
+
+// streamUntilReturn sends first, if valid, then the values received on the
+// reflected Go channel over the duplex channel until the Go channel is closed.
+// If the function sending them returns an error, the stream ends with it.
+func streamUntilReturn(r rpc.Responder, ch mux.Channel, valueCh reflect.Value, first reflect.Value, returned <-chan funcReturn) {
+	defer ch.Close()
+	closed := !first.IsValid()
+	if !closed && r.Send(first.Interface()) != nil {
+		drainValues(valueCh)
+		return
+	}
+	for !closed {
+		chosen, v, ok := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: valueCh},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(returned)},
+		})
+		switch {
+		case chosen == 1:
+			if err := v.Interface().(funcReturn).err; err != nil {
+				// send what was sent before returning, then the error
+				for {
+					v, ok := valueCh.TryRecv()
+					if !ok {
+						break
+					}
+					if r.Send(v.Interface()) != nil {
+						go drainValues(valueCh)
+						return
+					}
+				}
+				go drainValues(valueCh)
+				r.Send(streamError{Error: rpc.RemoteErrorFrom(err)})
+				return
+			}
+			// values can still be sent after returning
+			sendValues(r, valueCh)
+			return
+		case !ok:
+			closed = true
+		default:
+			if r.Send(v.Interface()) != nil {
+				drainValues(valueCh)
+				return
+			}
+		}
+	}
+	if err := (<-returned).err; err != nil {
+		r.Send(streamError{Error: rpc.RemoteErrorFrom(err)})
+	}
 }
 
-// streamValues will receive on the reflected Go channel and send over the
-// duplex channel until an error is returned or either are closed.
+// streamValues will send the values received on the reflected Go channel over
+// the duplex channel until the Go channel is closed, then close the duplex channel.
 func streamValues(r rpc.Responder, ch mux.Channel, valueCh reflect.Value) {
 	defer ch.Close()
+	sendValues(r, valueCh)
+}
+
+// sendValues will send the values received on the reflected Go channel until it
+// is closed. If sending fails, the Go channel is drained so senders are not blocked.
+func sendValues(r rpc.Responder, valueCh reflect.Value) {
 	for {
 		v, ok := valueCh.Recv()
 		if !ok {
 			return
 		}
 		if err := r.Send(v.Interface()); err != nil {
+			drainValues(valueCh)
+			return
+		}
+	}
+}
+
+// drainValues will receive on the reflected Go channel until it is closed.
+func drainValues(valueCh reflect.Value) {
+	for {
+		if _, ok := valueCh.Recv(); !ok {
+			return
+		}
+	}
+}
+
+// receiveValues will receive values from the call and send them on the
+// reflected Go channel until an error is returned or done is closed, then
+// closes the Go channel.
+func receiveValues(c *rpc.Call, valueCh reflect.Value, done chan struct{}) {
+	defer valueCh.Close()
+	for {
+		v := reflect.New(valueCh.Type().Elem())
+		if err := c.Receive(v.Interface()); err != nil {
+			return
+		}
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: valueCh, Send: v.Elem()},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		})
+		if chosen == 1 {
 			return
 		}
 	}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/rpc"
@@ -117,6 +118,31 @@ func TestHandlerFromFunc(t *testing.T) {
 		}
 	})
 
+	t.Run("with context", func(t *testing.T) {
+		client, _ := rpctest.NewPair(HandlerFrom(func(ctx context.Context, a, b int) (int, error) {
+			if _, ok := ctx.Deadline(); !ok {
+				return 0, fmt.Errorf("expected call context with deadline")
+			}
+			return a + b, nil
+		}), codec.JSONCodec{})
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		var sum int
+		if _, err := client.Call(ctx, "", []interface{}{2, 3}, &sum); err != nil {
+			t.Fatal(err)
+		}
+		if sum != 5 {
+			t.Fatalf("unexpected sum: %v", sum)
+		}
+
+		_, err := client.Call(ctx, "", []interface{}{2}, &sum)
+		if err == nil || !strings.Contains(err.Error(), "expected 2 params") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
 	t.Run("with call", func(t *testing.T) {
 		client, _ := rpctest.NewPair(HandlerFrom(func(a, b int, call *rpc.Call) int {
 			if call.Selector() != "/sum" {
@@ -362,3 +388,34 @@ func TestMethodHandlerFunc(t *testing.T) {
 		t.Fatalf("unexpected ret: %v", ret)
 	}
 }
+
+func TestHandlerFromDescribe(t *testing.T) {
+	m := rpc.NewRespondMux()
+	m.Handle("sum", HandlerFrom(func(a, b int, c *rpc.Call) (int, error) {
+		return a + b, nil
+	}))
+	m.Handle("methods", HandlerFrom(&mockMethods{}))
+	m.Handle("join", HandlerFrom(func(sep string, parts ...string) string {
+		return ""
+	}))
+
+	infos := map[string]rpc.SelectorInfo{}
+	for _, info := range m.Selectors() {
+		infos[info.Selector] = info
+	}
+	for selector, want := range map[string]string{
+		"sum":         "(int, int) (int, error)",
+		"methods.Foo": "() (string)",
+		"methods.Bar": "() ()",
+		"join":        "(string, ...string) (string)",
+	} {
+		info, ok := infos[selector]
+		if !ok {
+			t.Fatalf("missing selector %s: %v", selector, infos)
+		}
+		got := fmt.Sprintf("(%s) (%s)", strings.Join(info.Params, ", "), strings.Join(info.Returns, ", "))
+		if got != want {
+			t.Fatalf("unexpected signature for %s: %s", selector, got)
+		}
+	}
+}
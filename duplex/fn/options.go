@@ -0,0 +1,81 @@
+package fn
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Options configure how HandlerWith registers methods and how ClientWith
+// calls them. The zero value is what HandlerFrom and ClientFor use.
+type Options struct {
+	// Naming returns the selector name to use for a method or field name.
+	// Names are used as is when nil. See LowerCamel and SnakeCase.
+	Naming func(name string) string
+
+	// Exclude lists methods and fields that are not registered, either by
+	// name or by the dotted path of names from the top level, as in "Users.Delete".
+	Exclude []string
+
+	// Nested mounts sub handlers under the name of exported struct fields that
+	// are structs or struct pointers, and of methods without arguments returning
+	// a struct or struct pointer, which are called once when the handler is made.
+	// Sub handlers use the same options. Fields that are rpc.Handlers, including
+	// structs implementing it, are mounted as is.
+	Nested bool
+
+	// Validate checks arguments against the JSON Schema of the parameters,
+	// as described by SchemaFor, before converting them. Calls with invalid
+	// arguments return an error wrapping rpc.ErrInvalidArgument.
+	Validate bool
+}
+
+func (o Options) name(name string) string {
+	if o.Naming == nil {
+		return name
+	}
+	return o.Naming(name)
+}
+
+func (o Options) excluded(path, name string) bool {
+	for _, e := range o.Exclude {
+		if e == name || e == path {
+			return true
+		}
+	}
+	return false
+}
+
+// LowerCamel returns name with its leading upper case letters in lower case,
+// keeping the last one of an initialism that starts a new word, so "UserID"
+// becomes "userID" and "HTTPServer" becomes "httpServer".
+func LowerCamel(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// SnakeCase returns name in lower case with words separated by underscores,
+// so "UserID" becomes "user_id" and "HTTPServer" becomes "http_server".
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,178 @@
+package fn
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/rpc/rpctest"
+)
+
+func TestNaming(t *testing.T) {
+	for _, td := range []struct {
+		name, lowerCamel, snakeCase string
+	}{
+		{"Get", "get", "get"},
+		{"GetUser", "getUser", "get_user"},
+		{"UserID", "userID", "user_id"},
+		{"HTTPServer", "httpServer", "http_server"},
+		{"ID", "id", "id"},
+		{"V2Users", "v2Users", "v2_users"},
+		{"already", "already", "already"},
+	} {
+		if got := LowerCamel(td.name); got != td.lowerCamel {
+			t.Errorf("LowerCamel(%q) = %q, expected %q", td.name, got, td.lowerCamel)
+		}
+		if got := SnakeCase(td.name); got != td.snakeCase {
+			t.Errorf("SnakeCase(%q) = %q, expected %q", td.name, got, td.snakeCase)
+		}
+	}
+}
+
+type userService struct {
+	names map[string]string
+}
+
+func (s *userService) GetUser(id string) string {
+	return s.names[id]
+}
+
+func (s *userService) DeleteUser(id string) {
+	delete(s.names, id)
+}
+
+type reportService struct{}
+
+func (reportService) Daily() string {
+	return "daily"
+}
+
+type adminService struct {
+	Users  *userService
+	Parent *adminService
+	Mux    *rpc.RespondMux
+	Config struct{ Debug bool }
+	Nil    *userService
+
+	unexported *userService
+}
+
+func (a *adminService) Ping() string {
+	return "pong"
+}
+
+func (a *adminService) Reports() reportService {
+	return reportService{}
+}
+
+func (a *adminService) Close() {}
+
+func newAdminService() *adminService {
+	a := &adminService{
+		Users: &userService{names: map[string]string{"1": "alice"}},
+		Mux:   rpc.NewRespondMux(),
+	}
+	a.Parent = a
+	a.Mux.Handle("echo", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var v any
+		c.Receive(&v)
+		r.Return(v)
+	}))
+	return a
+}
+
+func TestHandlerWith(t *testing.T) {
+	h := HandlerWith(newAdminService(), Options{
+		Naming:  SnakeCase,
+		Exclude: []string{"Close", "Users.DeleteUser"},
+		Nested:  true,
+	})
+	var selectors []string
+	for _, info := range h.(*rpc.RespondMux).Selectors() {
+		selectors = append(selectors, info.Selector)
+	}
+	expected := []string{"mux.echo", "ping", "reports.daily", "users.get_user"}
+	if !reflect.DeepEqual(selectors, expected) {
+		t.Fatalf("unexpected selectors: %v", selectors)
+	}
+
+	t.Run("without nested", func(t *testing.T) {
+		h := HandlerWith(newAdminService(), Options{Naming: LowerCamel})
+		var selectors []string
+		for _, info := range h.(*rpc.RespondMux).Selectors() {
+			selectors = append(selectors, info.Selector)
+		}
+		expected := []string{"close", "ping", "reports"}
+		if !reflect.DeepEqual(selectors, expected) {
+			t.Fatalf("unexpected selectors: %v", selectors)
+		}
+	})
+
+	t.Run("recursive value methods", func(t *testing.T) {
+		h := HandlerWith(treeService{}, Options{Naming: LowerCamel, Nested: true})
+		var selectors []string
+		for _, info := range h.(*rpc.RespondMux).Selectors() {
+			selectors = append(selectors, info.Selector)
+		}
+		expected := []string{"node.name"}
+		if !reflect.DeepEqual(selectors, expected) {
+			t.Fatalf("unexpected selectors: %v", selectors)
+		}
+	})
+}
+
+type treeService struct{}
+
+func (treeService) Node() treeNode {
+	return treeNode{}
+}
+
+type treeNode struct{}
+
+func (treeNode) Name() string {
+	return "node"
+}
+
+func (treeNode) Next() treeNode {
+	return treeNode{}
+}
+
+type adminClient struct {
+	Ping  func() string
+	Users struct {
+		GetUser func(ctx context.Context, id string) (string, error)
+	}
+	Reports *struct {
+		Daily func() string
+	}
+	Parent *adminClient
+}
+
+func TestClientWith(t *testing.T) {
+	opts := Options{Naming: LowerCamel, Nested: true}
+	client, _ := rpctest.NewPair(HandlerWith(newAdminService(), opts), codec.JSONCodec{})
+	defer client.Close()
+
+	admin := ClientWith[adminClient](client, "", opts)
+	if s := admin.Ping(); s != "pong" {
+		t.Fatalf("unexpected ping: %v", s)
+	}
+	name, err := admin.Users.GetUser(context.Background(), "1")
+	fatal(err, t)
+	if name != "alice" {
+		t.Fatalf("unexpected name: %v", name)
+	}
+	if s := admin.Reports.Daily(); s != "daily" {
+		t.Fatalf("unexpected report: %v", s)
+	}
+	if admin.Parent != nil {
+		t.Fatal("expected recursive client field to be nil")
+	}
+
+	var ret string
+	if _, err := client.Call(context.Background(), "users.getUser", Args{"1"}, &ret); err != nil || ret != "alice" {
+		t.Fatalf("unexpected call result: %v %v", ret, err)
+	}
+}
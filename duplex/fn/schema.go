@@ -0,0 +1,348 @@
+package fn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// SchemaSelector is the selector ServeSchema registers its handler at.
+const SchemaSelector = "rpc.schema"
+
+// OpenRPCVersion is the version of the OpenRPC specification of Documents.
+const OpenRPCVersion = "1.2.6"
+
+// Document is an OpenRPC document describing the selectors of a RespondMux.
+type Document struct {
+	OpenRPC    string     `json:"openrpc"`
+	Info       Info       `json:"info"`
+	Methods    []Method   `json:"methods"`
+	Components Components `json:"components"`
+}
+
+// Info describes the service of a Document.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Method describes a selector. Params are positional, in the order of
+// Args, and Result describes the first return value. Any other return
+// values are described by the "x-results" extension.
+type Method struct {
+	Name           string               `json:"name"`
+	ParamStructure string               `json:"paramStructure,omitempty"`
+	Params         []ContentDescriptor  `json:"params"`
+	Result         *ContentDescriptor   `json:"result,omitempty"`
+	Results        []*ContentDescriptor `json:"x-results,omitempty"`
+}
+
+// ContentDescriptor describes a parameter or return value.
+type ContentDescriptor struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// Components holds the schemas of named struct types referenced by Ref.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is the subset of JSON Schema used to describe Go types.
+// The zero value allows any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// refPrefix is the prefix of Refs to schemas in Components.
+const refPrefix = "#/components/schemas/"
+
+// ServeSchema registers a handler on m at SchemaSelector that
+// returns the Document for the handlers registered on m.
+func ServeSchema(m *rpc.RespondMux, info Info) {
+	m.Handle(SchemaSelector, rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		c.Receive(nil)
+		r.Return(SchemaFor(m, info))
+	}))
+}
+
+// SchemaFor returns an OpenRPC Document describing the handlers registered on m.
+// Parameters and results are only described for handlers made with HandlerFrom,
+// using JSON Schema for the Go types and the json tags of struct fields. Other
+// handlers are listed with no parameters. Parameters have no names in Go, so
+// they are named after their position, as in "arg0".
+func SchemaFor(m *rpc.RespondMux, info Info) Document {
+	g := &schemaGen{defs: map[string]*Schema{}}
+	doc := Document{OpenRPC: OpenRPCVersion, Info: info, Methods: []Method{}}
+	m.Walk(func(selector string, h rpc.Handler) {
+		method := Method{Name: selector, Params: []ContentDescriptor{}}
+		if fh, ok := h.(*funcHandler); ok {
+			method.ParamStructure = "by-position"
+			method.Params = g.params(fh.args)
+			for i, t := range fh.returns() {
+				d := &ContentDescriptor{Name: fmt.Sprintf("result%d", i), Schema: g.schema(t)}
+				if i == 0 {
+					method.Result = d
+				} else {
+					method.Results = append(method.Results, d)
+				}
+			}
+		}
+		doc.Methods = append(doc.Methods, method)
+	})
+	if len(g.defs) > 0 {
+		doc.Components.Schemas = g.defs
+	}
+	return doc
+}
+
+// schemaGen makes schemas, adding named struct types to defs.
+type schemaGen struct {
+	defs map[string]*Schema
+}
+
+// params returns descriptors for the parameters of the function type fntyp.
+func (g *schemaGen) params(fntyp reflect.Type) []ContentDescriptor {
+	params := []ContentDescriptor{}
+	for i := 0; i < fntyp.NumIn(); i++ {
+		params = append(params, ContentDescriptor{
+			Name:     fmt.Sprintf("arg%d", i),
+			Required: !fntyp.IsVariadic() || i < fntyp.NumIn()-1,
+			Schema:   g.schema(fntyp.In(i)),
+		})
+	}
+	return params
+}
+
+func (g *schemaGen) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: "string", ContentEncoding: "base64"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		min := 0.0
+		return &Schema{Type: "integer", Minimum: &min}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Array:
+		n := t.Len()
+		return &Schema{Type: "array", Items: g.schema(t.Elem()), MinItems: &n, MaxItems: &n}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Func:
+		// functions are sent as Callbacks
+		return g.object(callbackType)
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := t.String()
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = &Schema{} // placeholder for recursive types
+			*g.defs[name] = *g.object(t)
+		}
+		return &Schema{Ref: refPrefix + name}
+	default:
+		// interfaces, and types that can't be sent
+		return &Schema{}
+	}
+}
+
+// object returns the schema for the struct type t, using the json tags of fields.
+// Fields are required unless they are pointers or tagged omitempty.
+func (g *schemaGen) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || len(f.Index) > 1 && !promoted(t, f) {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" && isStruct(f.Type) {
+			// fields of embedded structs are promoted by VisibleFields
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if f.Type.Kind() != reflect.Pointer && !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// promoted reports whether the field f of an embedded struct is promoted,
+// which is not the case when an embedding field has a json name.
+func promoted(t reflect.Type, f reflect.StructField) bool {
+	for i := 1; i < len(f.Index); i++ {
+		if name, _, _ := strings.Cut(t.FieldByIndex(f.Index[:i]).Tag.Get("json"), ","); name != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validator validates values decoded by a codec against schemas.
+type validator struct {
+	defs map[string]*Schema
+}
+
+// validateArgs returns an error if the arguments don't match the parameters,
+// ignoring any missing or extra arguments, which are checked by ArgsTo.
+func (v *validator) validateArgs(params []ContentDescriptor, variadic bool, args []any) error {
+	for i, arg := range args {
+		var s *Schema
+		switch {
+		case variadic && i >= len(params)-1:
+			s = params[len(params)-1].Schema
+			if i == len(params)-1 && len(args) == len(params) && isList(arg) {
+				break
+			}
+			s = s.Items
+		case i < len(params):
+			s = params[i].Schema
+		default:
+			return nil
+		}
+		if err := v.validate(arg, s, fmt.Sprintf("arg%d", i)); err != nil {
+			return fmt.Errorf("%w: param %d: %s", rpc.ErrInvalidArgument, i, err)
+		}
+	}
+	return nil
+}
+
+// validate returns an error if value doesn't match s. It allows for the ways
+// codecs encode values: CBOR encodes []byte as bytes and time.Time as Unix
+// seconds. Like ArgsTo, nil is valid for any schema.
+func (v *validator) validate(value any, s *Schema, path string) error {
+	if s.Ref != "" {
+		s = v.defs[strings.TrimPrefix(s.Ref, refPrefix)]
+	}
+	if value == nil || s == nil || s.Type == "" {
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	errorf := func(format string, args ...any) error {
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+	switch s.Type {
+	case "boolean":
+		if rv.Kind() != reflect.Bool {
+			return errorf("expected boolean, got %T", value)
+		}
+	case "integer", "number":
+		var n float64
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = rv.Float()
+			if s.Type == "integer" && n != math.Trunc(n) {
+				return errorf("expected integer, got %v", n)
+			}
+		default:
+			return errorf("expected %s, got %T", s.Type, value)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return errorf("expected at least %v, got %v", *s.Minimum, n)
+		}
+	case "string":
+		switch {
+		case s.ContentEncoding == "base64" && rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		case s.Format == "date-time" && (rv.Type() == timeType || rv.CanInt() || rv.CanUint() || rv.CanFloat()):
+		case rv.Kind() != reflect.String:
+			return errorf("expected string, got %T", value)
+		case s.ContentEncoding == "base64":
+			if _, err := base64.StdEncoding.DecodeString(rv.String()); err != nil {
+				return errorf("expected base64 string")
+			}
+		case s.Format == "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, rv.String()); err != nil {
+				return errorf("expected date-time string")
+			}
+		}
+	case "array":
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return errorf("expected array, got %T", value)
+		}
+		if s.MinItems != nil && rv.Len() < *s.MinItems {
+			return errorf("expected at least %d items, got %d", *s.MinItems, rv.Len())
+		}
+		if s.MaxItems != nil && rv.Len() > *s.MaxItems {
+			return errorf("expected at most %d items, got %d", *s.MaxItems, rv.Len())
+		}
+		if s.Items != nil {
+			for i := 0; i < rv.Len(); i++ {
+				if err := v.validate(rv.Index(i).Interface(), s.Items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		if rv.Kind() != reflect.Map {
+			return errorf("expected object, got %T", value)
+		}
+		props := map[string]any{}
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, ok := iter.Key().Interface().(string)
+			if !ok {
+				return errorf("expected string keys, got %T", iter.Key().Interface())
+			}
+			props[key] = iter.Value().Interface()
+		}
+		for _, name := range s.Required {
+			if _, ok := props[name]; !ok {
+				return errorf("missing property %q", name)
+			}
+		}
+		for key, val := range props {
+			ps := s.Properties[key]
+			if ps == nil {
+				ps = s.AdditionalProperties
+			}
+			if ps == nil {
+				continue
+			}
+			if err := v.validate(val, ps, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package fn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/rpc/rpctest"
+)
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaUser struct {
+	schemaBase
+	Name    string            `json:"name"`
+	Email   string            `json:"email,omitempty"`
+	Born    time.Time         `json:"born"`
+	Avatar  []byte            `json:"avatar,omitempty"`
+	Age     uint8             `json:"age"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Friends []*schemaUser     `json:"friends,omitempty"`
+	Secret  string            `json:"-"`
+}
+
+type schemaService struct{}
+
+func (schemaService) Save(ctx context.Context, u schemaUser, notify bool) (string, error) {
+	return u.ID + ":" + u.Name, nil
+}
+
+func (schemaService) Sum(nums ...int) int {
+	var sum int
+	for _, n := range nums {
+		sum += n
+	}
+	return sum
+}
+
+func (schemaService) Pair() (int, string) {
+	return 1, "one"
+}
+
+func TestSchemaFor(t *testing.T) {
+	m := rpc.NewRespondMux()
+	m.Handle("users", HandlerFrom(schemaService{}))
+	m.Handle("raw", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {}))
+	ServeSchema(m, Info{Title: "test", Version: "1.0"})
+
+	doc := SchemaFor(m, Info{Title: "test", Version: "1.0"})
+	b, err := json.Marshal(doc)
+	fatal(err, t)
+
+	for _, expected := range []string{
+		`"openrpc":"1.2.6"`,
+		`"info":{"title":"test","version":"1.0"}`,
+		`{"name":"raw","params":[]}`,
+		`{"name":"users.Pair","paramStructure":"by-position","params":[],"result":{"name":"result0","schema":{"type":"integer"}},"x-results":[{"name":"result1","schema":{"type":"string"}}]}`,
+		`{"name":"users.Save","paramStructure":"by-position","params":[{"name":"arg0","required":true,"schema":{"$ref":"#/components/schemas/fn.schemaUser"}},{"name":"arg1","required":true,"schema":{"type":"boolean"}}],"result":{"name":"result0","schema":{"type":"string"}}}`,
+		`{"name":"users.Sum","paramStructure":"by-position","params":[{"name":"arg0","schema":{"type":"array","items":{"type":"integer"}}}],"result":{"name":"result0","schema":{"type":"integer"}}}`,
+		`"fn.schemaUser":{"type":"object","properties":{"age":{"type":"integer","minimum":0},"avatar":{"type":"string","contentEncoding":"base64"},"born":{"type":"string","format":"date-time"},"email":{"type":"string"},"friends":{"type":"array","items":{"$ref":"#/components/schemas/fn.schemaUser"}},"id":{"type":"string"},"name":{"type":"string"},"tags":{"type":"object","additionalProperties":{"type":"string"}}},"required":["id","name","born","age"]}`,
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Fatalf("expected schema to contain:\n%s\ngot:\n%s", expected, b)
+		}
+	}
+	if strings.Contains(string(b), "Secret") {
+		t.Fatalf("unexpected ignored field in schema: %s", b)
+	}
+
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			client, _ := rpctest.NewPair(m, cd)
+			defer client.Close()
+
+			var remote Document
+			_, err := client.Call(context.Background(), SchemaSelector, nil, &remote)
+			fatal(err, t)
+			rb, err := json.Marshal(remote)
+			fatal(err, t)
+			if string(rb) != string(b) {
+				t.Fatalf("unexpected remote schema:\n%s\nexpected:\n%s", rb, b)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := rpc.NewRespondMux()
+	m.Handle("users", HandlerWith(schemaService{}, Options{Validate: true}))
+	born := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			client, _ := rpctest.NewPair(m, cd)
+			defer client.Close()
+			ctx := context.Background()
+
+			var ret string
+			_, err := client.Call(ctx, "users.Save", Args{schemaUser{
+				schemaBase: schemaBase{ID: "1"},
+				Name:       "alice",
+				Born:       born,
+				Avatar:     []byte("png"),
+			}, true}, &ret)
+			fatal(err, t)
+			if ret != "1:alice" {
+				t.Fatalf("unexpected return: %v", ret)
+			}
+
+			var sum int
+			_, err = client.Call(ctx, "users.Sum", Args{1, 2, 3}, &sum)
+			fatal(err, t)
+			if sum != 6 {
+				t.Fatalf("unexpected sum: %v", sum)
+			}
+
+			for _, td := range []struct {
+				selector string
+				args     Args
+				err      string
+			}{
+				{"users.Save", Args{map[string]any{"id": "1", "born": born}, true}, `param 0: arg0: missing property "name"`},
+				{"users.Save", Args{map[string]any{"id": "1", "name": 2, "born": born, "age": 1}, true}, "param 0: arg0.name: expected string"},
+				{"users.Save", Args{map[string]any{"id": "1", "name": "a", "born": born, "age": -1}, true}, "param 0: arg0.age: expected at least 0"},
+				{"users.Save", Args{map[string]any{"id": "1", "name": "a", "born": born, "age": 1, "friends": []any{map[string]any{"id": 2, "name": "b", "born": born, "age": 1}}}, true}, "param 0: arg0.friends[0].id: expected string"},
+				{"users.Save", Args{map[string]any{"id": "1", "name": "a", "born": "yesterday", "age": 1}, true}, "param 0: arg0.born: expected date-time string"},
+				{"users.Save", Args{map[string]any{"id": "1", "name": "a", "born": born, "age": 1}, "yes"}, "param 1: arg1: expected boolean"},
+				{"users.Sum", Args{1, "two"}, "param 1: arg1: expected integer"},
+			} {
+				_, err := client.Call(ctx, td.selector, td.args)
+				if !errors.Is(err, rpc.ErrInvalidArgument) || !strings.Contains(err.Error(), td.err) {
+					t.Fatalf("expected invalid argument error containing %q, got: %v", td.err, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package fn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// SendStream calls selector with args, then streams the values received from ch
+// until it is closed. It is used with handlers of functions taking a receive-only
+// channel argument, which gets the streamed values. Once ch is closed, the call
+// returns the values returned by the function into reply.
+func SendStream[T any](ctx context.Context, caller rpc.Caller, selector string, args Args, ch <-chan T, reply ...any) (*rpc.Response, error) {
+	if args == nil {
+		args = Args{}
+	}
+	stream := make(chan any)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(stream)
+		select {
+		case stream <- args:
+		case <-done:
+			return
+		}
+		for v := range ch {
+			select {
+			case stream <- v:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return caller.Call(ctx, selector, stream, reply...)
+}
+
+// streamError is sent as the last value of a stream to end it with an error
+// returned by the function streaming the values after the stream started.
+type streamError struct {
+	Error rpc.RemoteError `json:"$error"`
+}
+
+var remoteErrorType = reflect.TypeOf(rpc.RemoteError{})
+
+// Stream is a stream of values received with ReceiveStream.
+type Stream[T any] struct {
+	// C gets the streamed values. It is closed when the stream ends or the
+	// context is done.
+	C <-chan T
+
+	err error
+}
+
+// Err returns the error the stream ended with, such as an error returned by the
+// function streaming the values, or nil if it ended normally. It is only set
+// once C is closed.
+func (s *Stream[T]) Err() error {
+	return s.err
+}
+
+// ReceiveStream calls selector with args, putting the returned values in reply,
+// and returns a Stream getting the values streamed back. It is used with handlers
+// of functions taking a channel argument or returning a channel as the first value.
+// Values are decoded the same way as arguments, as described by ArgsTo.
+func ReceiveStream[T any](ctx context.Context, caller rpc.Caller, selector string, args Args, reply ...any) (*Stream[T], *rpc.Response, error) {
+	if args == nil {
+		args = Args{}
+	}
+	resp, err := caller.Call(ctx, selector, args, reply...)
+	if err != nil {
+		return nil, resp, err
+	}
+	ch := make(chan T)
+	s := &Stream[T]{C: ch}
+	go func() {
+		s.err = receiveStream(ctx, resp, ch)
+		close(ch)
+	}()
+	return s, resp, nil
+}
+
+// receiveStream decodes the values streamed over resp and sends them on ch,
+// until the stream ends or ctx is done, returning the error it ended with.
+func receiveStream[T any](ctx context.Context, resp *rpc.Response, ch chan<- T) error {
+	defer resp.Close()
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	for {
+		var v any
+		if err := resp.Receive(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if e, ok := streamErrorFrom(v); ok {
+			return e
+		}
+		rv, err := decodeArg(v, typ)
+		if err != nil {
+			return err
+		}
+		var vv T
+		reflect.ValueOf(&vv).Elem().Set(rv)
+		select {
+		case ch <- vv:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// streamErrorFrom returns the error in v if it is a streamError.
+func streamErrorFrom(v any) (rpc.RemoteError, bool) {
+	var e any
+	switch m := v.(type) {
+	case map[string]any:
+		if len(m) != 1 {
+			return rpc.RemoteError{}, false
+		}
+		e = m["$error"]
+	case map[any]any:
+		if len(m) != 1 {
+			return rpc.RemoteError{}, false
+		}
+		e = m["$error"]
+	}
+	if e == nil {
+		return rpc.RemoteError{}, false
+	}
+	rv, err := decodeArg(e, remoteErrorType)
+	if err != nil {
+		return rpc.RemoteError{}, false
+	}
+	return rv.Interface().(rpc.RemoteError), true
+}
@@ -0,0 +1,261 @@
+package fn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/rpc/rpctest"
+)
+
+type streamService struct {
+	next   chan struct{} // lets Watch send its second value
+	start  chan struct{} // lets the producer for Start send
+	fail   chan struct{} // lets the producer for Fail send
+	failed chan struct{} // closed once the producer for Fail is done
+}
+
+func newStreamService() streamService {
+	return streamService{
+		next:   make(chan struct{}),
+		start:  make(chan struct{}),
+		fail:   make(chan struct{}),
+		failed: make(chan struct{}),
+	}
+}
+
+func (streamService) Sum(scale int, nums <-chan int) int {
+	var sum int
+	for n := range nums {
+		sum += n * scale
+	}
+	return sum
+}
+
+func (streamService) Count(n int, out chan<- int) {
+	for i := 1; i <= n; i++ {
+		out <- i
+	}
+	close(out)
+}
+
+func (s streamService) Start(out chan<- int) string {
+	go func() {
+		<-s.start
+		out <- 1
+		close(out)
+	}()
+	return "started"
+}
+
+func (s streamService) Watch(ctx context.Context, out chan<- int) error {
+	out <- 1
+	select {
+	case <-s.next:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	out <- 2
+	return fmt.Errorf("%w: watched file removed", rpc.ErrNotFound)
+}
+
+func (s streamService) Fail(out chan<- int) error {
+	go func() {
+		<-s.fail
+		for i := 1; i <= 1000; i++ {
+			out <- i
+		}
+		close(out)
+		close(s.failed)
+	}()
+	return errors.New("failed")
+}
+
+type streamUser struct {
+	UserName string `json:"user_name"`
+}
+
+func (streamService) Users() chan streamUser {
+	ch := make(chan streamUser, 1)
+	ch <- streamUser{UserName: "alice"}
+	close(ch)
+	return ch
+}
+
+func (streamService) Words() (chan string, error) {
+	ch := make(chan string, 2)
+	ch <- "hello"
+	ch <- "world"
+	close(ch)
+	return ch, nil
+}
+
+func TestStream(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			svc := newStreamService()
+			m := rpc.NewRespondMux()
+			m.Handle("stream", HandlerFrom(svc))
+			client, _ := rpctest.NewPair(m, cd)
+			defer client.Close()
+			ctx := context.Background()
+
+			t.Run("send stream", func(t *testing.T) {
+				nums := make(chan int)
+				go func() {
+					for i := 1; i <= 4; i++ {
+						nums <- i
+					}
+					close(nums)
+				}()
+				var sum int
+				_, err := SendStream(ctx, client, "stream.Sum", Args{10}, nums, &sum)
+				fatal(err, t)
+				if sum != 100 {
+					t.Fatalf("unexpected sum: %v", sum)
+				}
+			})
+
+			t.Run("send empty stream", func(t *testing.T) {
+				nums := make(chan int)
+				close(nums)
+				var sum int
+				_, err := SendStream(ctx, client, "stream.Sum", Args{10}, nums, &sum)
+				fatal(err, t)
+				if sum != 0 {
+					t.Fatalf("unexpected sum: %v", sum)
+				}
+			})
+
+			t.Run("receive stream from param", func(t *testing.T) {
+				s, _, err := ReceiveStream[int](ctx, client, "stream.Count", Args{1000})
+				fatal(err, t)
+				var n int
+				for v := range s.C {
+					n++
+					if v != n {
+						t.Fatalf("unexpected streamed value: %v", v)
+					}
+				}
+				fatal(s.Err(), t)
+				if n != 1000 {
+					t.Fatalf("expected 1000 streamed values, got %v", n)
+				}
+			})
+
+			t.Run("receive stream after return", func(t *testing.T) {
+				var ret string
+				s, _, err := ReceiveStream[int](ctx, client, "stream.Start", nil, &ret)
+				fatal(err, t)
+				if ret != "started" {
+					t.Fatalf("unexpected ret: %v", ret)
+				}
+				close(svc.start)
+				var vals []int
+				for v := range s.C {
+					vals = append(vals, v)
+				}
+				if !reflect.DeepEqual(vals, []int{1}) {
+					t.Fatalf("unexpected streamed values: %v", vals)
+				}
+			})
+
+			t.Run("receive stream while running", func(t *testing.T) {
+				s, _, err := ReceiveStream[int](ctx, client, "stream.Watch", nil)
+				fatal(err, t)
+				select {
+				case v := <-s.C:
+					if v != 1 {
+						t.Fatalf("unexpected streamed value: %v", v)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("expected value before the function returns")
+				}
+				close(svc.next)
+				if v := <-s.C; v != 2 {
+					t.Fatalf("unexpected streamed value: %v", v)
+				}
+				if _, ok := <-s.C; ok {
+					t.Fatal("expected stream to end")
+				}
+				if !errors.Is(s.Err(), rpc.ErrNotFound) || !strings.Contains(s.Err().Error(), "watched file removed") {
+					t.Fatalf("unexpected stream error: %v", s.Err())
+				}
+			})
+
+			t.Run("receive stream error", func(t *testing.T) {
+				_, _, err := ReceiveStream[int](ctx, client, "stream.Fail", nil)
+				if err == nil || !strings.Contains(err.Error(), "failed") {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				close(svc.fail)
+				select {
+				case <-svc.failed:
+				case <-time.After(5 * time.Second):
+					t.Fatal("producer blocked after error")
+				}
+			})
+
+			t.Run("receive json tagged values", func(t *testing.T) {
+				s, _, err := ReceiveStream[streamUser](ctx, client, "stream.Users", nil)
+				fatal(err, t)
+				var users []streamUser
+				for u := range s.C {
+					users = append(users, u)
+				}
+				if !reflect.DeepEqual(users, []streamUser{{UserName: "alice"}}) {
+					t.Fatalf("unexpected streamed values: %v", users)
+				}
+			})
+
+			t.Run("receive stream from return", func(t *testing.T) {
+				s, _, err := ReceiveStream[string](ctx, client, "stream.Words", nil)
+				fatal(err, t)
+				var vals []string
+				for v := range s.C {
+					vals = append(vals, v)
+				}
+				if !reflect.DeepEqual(vals, []string{"hello", "world"}) {
+					t.Fatalf("unexpected streamed values: %v", vals)
+				}
+			})
+		})
+	}
+}
+
+func TestBatchedStream(t *testing.T) {
+	ctx := context.Background()
+	m := rpc.NewRespondMux()
+	m.Handle("stream", HandlerFrom(newStreamService()))
+	m.Handle(rpc.BatchSelector, rpc.BatchHandler(m))
+
+	sessA, sessB := mux.Pair()
+	srv := &rpc.Server{Codec: codec.JSONCodec{}, Handler: m}
+	go srv.Respond(sessA, nil)
+	client := rpc.NewClient(sessB, codec.JSONCodec{})
+	defer client.Close()
+
+	b := rpc.NewBatch(client)
+	p := b.Call("stream.Count", Args{3})
+	b.Send(ctx)
+	if p.Err() == nil || !strings.Contains(p.Err().Error(), "unable to continue") {
+		t.Fatalf("unexpected error: %v", p.Err())
+	}
+	// the server is still responding
+	s, _, err := ReceiveStream[int](ctx, client, "stream.Count", Args{2})
+	fatal(err, t)
+	var n int
+	for range s.C {
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 streamed values, got %v", n)
+	}
+}
@@ -0,0 +1,296 @@
+// Package forward implements TCP and Unix socket forwarding over duplex peers,
+// similar to ssh -L and ssh -R.
+//
+// Forwarding handlers are registered on a talk.Peer under the reserved selector
+// Namespace, so any peer can opt in by calling Register. With local forwarding,
+// connections accepted locally are carried over a new channel to the remote peer,
+// which dials the target. With remote forwarding, the remote peer listens and
+// carries connections it accepts back to be dialed locally. Remote forwarding
+// requires both sides to have called Register.
+package forward
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/talk"
+)
+
+// Namespace is the selector prefix reserved for forwarding handlers.
+const Namespace = "duplex.forward"
+
+// Addr is a network address to listen on or dial.
+type Addr struct {
+	Network string
+	Address string
+}
+
+// ParseAddr parses an address of the form "unix:/path/to/socket", "tcp:host:port"
+// or "host:port", which defaults to TCP.
+func ParseAddr(s string) Addr {
+	switch {
+	case strings.HasPrefix(s, "unix:"):
+		return Addr{Network: "unix", Address: strings.TrimPrefix(s, "unix:")}
+	case strings.HasPrefix(s, "tcp:"):
+		return Addr{Network: "tcp", Address: strings.TrimPrefix(s, "tcp:")}
+	default:
+		return Addr{Network: "tcp", Address: s}
+	}
+}
+
+func (a Addr) String() string {
+	return fmt.Sprintf("%s:%s", a.Network, a.Address)
+}
+
+// Forwarder serves forwarding requests from the remote side of a peer and
+// initiates local and remote forwarding over it.
+type Forwarder struct {
+	// Dial is used to connect to forwarding targets. If nil, a net.Dialer is used.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Listen is used to listen for remote forwarding requests. If nil, net.Listen is used.
+	Listen func(network, address string) (net.Listener, error)
+
+	peer    *talk.Peer
+	mu      sync.Mutex
+	remotes map[string]Addr
+}
+
+// Register mounts the forwarding handlers on the peer under Namespace and
+// returns a Forwarder to initiate forwarding over the peer.
+func Register(peer *talk.Peer) *Forwarder {
+	f := &Forwarder{
+		peer:    peer,
+		remotes: make(map[string]Addr),
+	}
+	peer.Handle(Namespace+".dial", rpc.HandlerFunc(f.handleDial))
+	peer.Handle(Namespace+".listen", rpc.HandlerFunc(f.handleListen))
+	peer.Handle(Namespace+".connect", rpc.HandlerFunc(f.handleConnect))
+	return f
+}
+
+// Local accepts connections on l and forwards each over a new channel to the
+// remote peer, which connects it to target. Local returns when l is closed
+// or ctx is done, closing l.
+func (f *Forwarder) Local(ctx context.Context, l net.Listener, target Addr) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			resp, err := f.peer.Call(ctx, Namespace+".dial", target, nil)
+			if err != nil {
+				log.Println("forward:", err)
+				conn.Close()
+				return
+			}
+			join(conn, resp.Channel)
+		}()
+	}
+}
+
+// Remote asks the remote peer to listen on addr and forward each connection it
+// accepts back over the peer, where it will be connected to target. It returns
+// the address the remote peer is listening on. Forwarding stops when ctx is done,
+// which closes the remote listener.
+func (f *Forwarder) Remote(ctx context.Context, addr, target Addr) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	f.remotes[id] = target
+	f.mu.Unlock()
+
+	var bound string
+	resp, err := f.peer.Call(ctx, Namespace+".listen", listenRequest{
+		ID:      id,
+		Network: addr.Network,
+		Address: addr.Address,
+	}, &bound)
+	if err != nil {
+		f.removeRemote(id)
+		return "", err
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		// the remote side closes the channel when its listener closes
+		io.Copy(io.Discard, resp.Channel)
+		close(closed)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-closed:
+		}
+		resp.Close()
+		f.removeRemote(id)
+	}()
+	return bound, nil
+}
+
+func (f *Forwarder) removeRemote(id string) {
+	f.mu.Lock()
+	delete(f.remotes, id)
+	f.mu.Unlock()
+}
+
+func (f *Forwarder) dial(ctx context.Context, addr Addr) (net.Conn, error) {
+	if f.Dial != nil {
+		return f.Dial(ctx, addr.Network, addr.Address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, addr.Network, addr.Address)
+}
+
+func (f *Forwarder) listen(addr Addr) (net.Listener, error) {
+	if f.Listen != nil {
+		return f.Listen(addr.Network, addr.Address)
+	}
+	return net.Listen(addr.Network, addr.Address)
+}
+
+type listenRequest struct {
+	ID      string
+	Network string
+	Address string
+}
+
+func (f *Forwarder) handleDial(r rpc.Responder, c *rpc.Call) {
+	var target Addr
+	if err := c.Receive(&target); err != nil {
+		r.Return(err)
+		return
+	}
+	conn, err := f.dial(c.Context, target)
+	if err != nil {
+		r.Return(err)
+		return
+	}
+	ch, err := r.Continue(nil)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	join(conn, ch)
+}
+
+func (f *Forwarder) handleListen(r rpc.Responder, c *rpc.Call) {
+	var req listenRequest
+	if err := c.Receive(&req); err != nil {
+		r.Return(err)
+		return
+	}
+	l, err := f.listen(Addr{Network: req.Network, Address: req.Address})
+	if err != nil {
+		r.Return(err)
+		return
+	}
+	ch, err := r.Continue(l.Addr().String())
+	if err != nil {
+		l.Close()
+		return
+	}
+	go func() {
+		// the caller closes the channel to stop forwarding
+		io.Copy(io.Discard, ch)
+		l.Close()
+	}()
+	defer ch.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			resp, err := c.Caller.Call(context.Background(), Namespace+".connect", req.ID, nil)
+			if err != nil {
+				log.Println("forward:", err)
+				conn.Close()
+				return
+			}
+			join(conn, resp.Channel)
+		}()
+	}
+}
+
+func (f *Forwarder) handleConnect(r rpc.Responder, c *rpc.Call) {
+	var id string
+	if err := c.Receive(&id); err != nil {
+		r.Return(err)
+		return
+	}
+	f.mu.Lock()
+	target, ok := f.remotes[id]
+	f.mu.Unlock()
+	if !ok {
+		r.Return(fmt.Errorf("forward: unknown remote forward: %s", id))
+		return
+	}
+	conn, err := f.dial(c.Context, target)
+	if err != nil {
+		r.Return(err)
+		return
+	}
+	ch, err := r.Continue(nil)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	join(conn, ch)
+}
+
+// join copies between a connection and channel in both directions until
+// both sides have finished writing, then closes them.
+func join(conn net.Conn, ch mux.Channel) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		io.Copy(conn, ch)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+		wg.Done()
+	}()
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+		wg.Done()
+	}()
+	wg.Wait()
+	conn.Close()
+	ch.Close()
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
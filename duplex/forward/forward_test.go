@@ -0,0 +1,116 @@
+package forward
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/talk"
+)
+
+func fatal(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newPeers(t *testing.T) (a, b *Forwarder) {
+	sessA, sessB := mux.Pair()
+	peerA := talk.NewPeer(sessA, codec.CBORCodec{})
+	peerB := talk.NewPeer(sessB, codec.CBORCodec{})
+	t.Cleanup(func() {
+		peerA.Close()
+		peerB.Close()
+	})
+	a = Register(peerA)
+	b = Register(peerB)
+	go peerA.Respond()
+	go peerB.Respond()
+	return
+}
+
+func startEcho(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	fatal(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func checkEcho(t *testing.T, addr string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	fatal(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "Hello world")
+	fatal(t, err)
+	fatal(t, conn.(*net.TCPConn).CloseWrite())
+	b, err := io.ReadAll(conn)
+	fatal(t, err)
+	if string(b) != "Hello world" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	for in, expected := range map[string]Addr{
+		"localhost:8080":     {Network: "tcp", Address: "localhost:8080"},
+		"tcp:127.0.0.1:22":   {Network: "tcp", Address: "127.0.0.1:22"},
+		"unix:/tmp/app.sock": {Network: "unix", Address: "/tmp/app.sock"},
+	} {
+		if actual := ParseAddr(in); actual != expected {
+			t.Errorf("%s: expected %v, got %v", in, expected, actual)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	a, _ := newPeers(t)
+	target := startEcho(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	fatal(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Local(ctx, l, Addr{Network: "tcp", Address: target})
+
+	checkEcho(t, l.Addr().String())
+	checkEcho(t, l.Addr().String())
+}
+
+func TestRemote(t *testing.T) {
+	a, _ := newPeers(t)
+	target := startEcho(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bound, err := a.Remote(ctx, Addr{Network: "tcp", Address: "127.0.0.1:0"}, Addr{Network: "tcp", Address: target})
+	fatal(t, err)
+
+	checkEcho(t, bound)
+	checkEcho(t, bound)
+}
+
+func TestRemoteUnknownListenError(t *testing.T) {
+	a, _ := newPeers(t)
+
+	_, err := a.Remote(context.Background(), Addr{Network: "bogus", Address: "nowhere"}, Addr{Network: "tcp", Address: "127.0.0.1:1"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
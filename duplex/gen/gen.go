@@ -0,0 +1,458 @@
+// Package gen generates typed clients and servers for Go interfaces that
+// interoperate with the reflection based clients and handlers of package fn.
+//
+// For each interface I, the generated code has:
+//
+//   - an IClient type implementing I by making calls with an rpc.Caller,
+//     with a NewIClient constructor registered with fn.RegisterClient
+//   - a RegisterI function registering a handler for each method of an
+//     implementation of I on an rpc.RespondMux
+//
+// Methods are called with their name as selector and their parameters as
+// fn.Args, leaving out a leading context.Context, which is used as the
+// context of the call, and a final *rpc.Call, which is given the call being
+// handled. Non-error returns are returned as the values of the response. If a
+// method has no error return, the client panics with call errors. These are
+// the same conventions used by fn.HandlerFrom and fn.ClientFor.
+//
+// Generate is used by the "duplex gen" command, which can be used with go:generate:
+//
+//	//go:generate duplex gen . Calculator
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Header is the first line of generated files. Files starting with it
+// are ignored when loading the package of the interfaces.
+const Header = "// Code generated by duplex gen. DO NOT EDIT."
+
+const (
+	rpcPath = "tractor.dev/toolkit-go/duplex/rpc"
+	fnPath  = "tractor.dev/toolkit-go/duplex/fn"
+)
+
+// Generate returns the source of a Go file for the package in dir with
+// a client and server for each of the named interfaces in it.
+func Generate(dir string, names ...string) ([]byte, error) {
+	if len(names) == 0 {
+		return nil, errors.New("gen: no interfaces")
+	}
+	pkg, err := load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{pkg: pkg, imports: map[string]string{}}
+	var body bytes.Buffer
+	for _, name := range names {
+		if err := g.generate(&body, name); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n\npackage %s\n\nimport (\n", Header, pkg.Name())
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if std(paths[i]) != std(paths[j]) {
+			return std(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	for i, path := range paths {
+		if i > 0 && std(path) != std(paths[i-1]) {
+			buf.WriteString("\n")
+		}
+		name := g.imports[path]
+		if name == filepath.Base(path) {
+			fmt.Fprintf(&buf, "\t%q\n", path)
+		} else {
+			fmt.Fprintf(&buf, "\t%s %q\n", name, path)
+		}
+	}
+	buf.WriteString(")\n")
+	buf.Write(body.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("gen: formatting source: %w", err)
+	}
+	return src, nil
+}
+
+// load parses and type checks the package in dir, leaving out generated files.
+// Type errors are only returned if the package is unusable, so stale
+// generated code in other files doesn't get in the way of regenerating it.
+func load(dir string) (*types.Package, error) {
+	bpkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("gen: %w", err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bpkg.GoFiles {
+		src, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("gen: %w", err)
+		}
+		if bytes.HasPrefix(src, []byte(Header)) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			return nil, fmt.Errorf("gen: %w", err)
+		}
+		files = append(files, f)
+	}
+
+	var typeErr error
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			if typeErr == nil {
+				typeErr = err
+			}
+		},
+	}
+	pkg, _ := conf.Check(bpkg.ImportPath, fset, files, nil)
+	if pkg == nil {
+		return nil, fmt.Errorf("gen: %w", typeErr)
+	}
+	if typeErr != nil && pkg.Scope().Len() == 0 {
+		return nil, fmt.Errorf("gen: %w", typeErr)
+	}
+	return pkg, nil
+}
+
+type generator struct {
+	pkg     *types.Package
+	imports map[string]string // path => name
+}
+
+// qualifier returns the name used for pkg in the generated file.
+func (g *generator) qualifier(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+	return g.use(pkg.Path(), pkg.Name())
+}
+
+// use adds an import for path and returns the name it can be used with.
+func (g *generator) use(path, name string) string {
+	if n, ok := g.imports[path]; ok {
+		return n
+	}
+	taken := func(n string) bool {
+		for _, v := range g.imports {
+			if v == n {
+				return true
+			}
+		}
+		return g.pkg.Scope().Lookup(n) != nil
+	}
+	n := name
+	for i := 2; taken(n); i++ {
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+	g.imports[path] = n
+	return n
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// method is a method of an interface with the parameters sent as Args.
+type method struct {
+	name      string
+	sig       *types.Signature
+	hasCtx    bool
+	hasCall   bool
+	params    []types.Type // sent as Args
+	returns   []types.Type // non-error returns
+	returnErr bool
+}
+
+func (g *generator) generate(w *bytes.Buffer, name string) error {
+	obj := g.pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("gen: %s not found in package %s", name, g.pkg.Name())
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("gen: %s is not a type", name)
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 {
+		return fmt.Errorf("gen: %s must be a non-generic named type", name)
+	}
+	iface, ok := named.Underlying().(*types.Interface)
+	if !ok {
+		return fmt.Errorf("gen: %s is not an interface", name)
+	}
+
+	var methods []method
+	for i := 0; i < iface.NumMethods(); i++ {
+		m, err := g.method(iface.Method(i))
+		if err != nil {
+			return fmt.Errorf("gen: %s.%w", name, err)
+		}
+		methods = append(methods, m)
+	}
+
+	g.writeClient(w, name, methods)
+	g.writeServer(w, name, methods)
+	return nil
+}
+
+func (g *generator) method(fn *types.Func) (method, error) {
+	m := method{name: fn.Name(), sig: fn.Type().(*types.Signature)}
+	if !fn.Exported() {
+		return m, fmt.Errorf("%s: method is not exported", m.name)
+	}
+	params := m.sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		t := params.At(i).Type()
+		switch {
+		case i == 0 && isNamed(t, "context", "Context"):
+			m.hasCtx = true
+		case i == params.Len()-1 && isCall(t):
+			m.hasCall = true
+		default:
+			if err := supported(t); err != nil {
+				return m, fmt.Errorf("%s: param %d: %w", m.name, i, err)
+			}
+			m.params = append(m.params, t)
+		}
+	}
+	results := m.sig.Results()
+	for i := 0; i < results.Len(); i++ {
+		t := results.At(i).Type()
+		if i == results.Len()-1 && isNamed(t, "", "error") {
+			m.returnErr = true
+			continue
+		}
+		if err := supported(t); err != nil {
+			return m, fmt.Errorf("%s: return %d: %w", m.name, i, err)
+		}
+		m.returns = append(m.returns, t)
+	}
+	for _, t := range append(m.params, m.returns...) {
+		if b, ok := t.(*types.Basic); ok && b.Kind() == types.Invalid {
+			return m, fmt.Errorf("%s: invalid type, package has errors", m.name)
+		}
+	}
+	return m, nil
+}
+
+// supported returns an error for types that can't be sent as values.
+func supported(t types.Type) error {
+	switch u := t.Underlying().(type) {
+	case *types.Chan:
+		return fmt.Errorf("channel types are not supported")
+	case *types.Signature:
+		return fmt.Errorf("func types are not supported")
+	case *types.Interface:
+		if !u.Empty() {
+			return fmt.Errorf("interface types are not supported")
+		}
+	}
+	return nil
+}
+
+func isNamed(t types.Type, path, name string) bool {
+	n, ok := t.(*types.Named)
+	if !ok || n.Obj().Name() != name {
+		return false
+	}
+	if n.Obj().Pkg() == nil {
+		return path == ""
+	}
+	return n.Obj().Pkg().Path() == path
+}
+
+func isCall(t types.Type) bool {
+	p, ok := t.(*types.Pointer)
+	return ok && isNamed(p.Elem(), rpcPath, "Call")
+}
+
+func (g *generator) writeClient(w *bytes.Buffer, name string, methods []method) {
+	client := name + "Client"
+	rpc := g.use(rpcPath, "rpc")
+	fn := g.use(fnPath, "fn")
+
+	fmt.Fprintf(w, `
+// %[1]s implements %[2]s by calling the methods of a remote %[2]s.
+type %[1]s struct {
+	caller %[3]s.Caller
+	prefix string
+}
+
+// New%[1]s returns a %[1]s calling the methods of a remote %[2]s,
+// registered at prefix, with caller.
+func New%[1]s(caller %[3]s.Caller, prefix string) *%[1]s {
+	return &%[1]s{caller: caller, prefix: prefix}
+}
+
+func init() {
+	%[4]s.RegisterClient(func(caller %[3]s.Caller, prefix string) %[2]s {
+		return New%[1]s(caller, prefix)
+	})
+}
+
+func (c *%[1]s) selector(name string) string {
+	if c.prefix == "" {
+		return name
+	}
+	return c.prefix + "." + name
+}
+`, client, name, rpc, fn)
+
+	for _, m := range methods {
+		var params, args, results, replies, zeros []string
+		ctx := g.use("context", "context") + ".Background()"
+		if m.hasCtx {
+			params = append(params, "ctx "+g.typeString(m.sig.Params().At(0).Type()))
+			ctx = "ctx"
+		}
+		for i, t := range m.params {
+			arg := fmt.Sprintf("a%d", i)
+			typ := g.typeString(t)
+			if m.sig.Variadic() && i == len(m.params)-1 {
+				typ = "..." + g.typeString(t.(*types.Slice).Elem())
+			}
+			params = append(params, arg+" "+typ)
+			args = append(args, arg)
+		}
+		if m.hasCall {
+			params = append(params, "_ *"+rpc+".Call")
+		}
+		for i, t := range m.returns {
+			results = append(results, g.typeString(t))
+			replies = append(replies, fmt.Sprintf("&r%d", i))
+			zeros = append(zeros, fmt.Sprintf("r%d", i))
+		}
+		if m.returnErr {
+			results = append(results, "error")
+		}
+
+		fmt.Fprintf(w, "\n// %s calls %q on the remote %s.\n", m.name, m.name, name)
+		fmt.Fprintf(w, "func (c *%s) %s(%s) %s {\n", client, m.name, strings.Join(params, ", "), resultList(results))
+		for i, t := range m.returns {
+			fmt.Fprintf(w, "\tvar r%d %s\n", i, g.typeString(t))
+		}
+		call := fmt.Sprintf("c.caller.Call(%s, c.selector(%q), %s.Args{%s}", ctx, m.name, fn, strings.Join(args, ", "))
+		if len(replies) > 0 {
+			call += ", " + strings.Join(replies, ", ")
+		}
+		call += ")"
+		if m.returnErr {
+			fmt.Fprintf(w, "\t_, err := %s\n", call)
+			fmt.Fprintf(w, "\treturn %s\n", strings.Join(append(zeros, "err"), ", "))
+		} else {
+			fmt.Fprintf(w, "\tif _, err := %s; err != nil {\n\t\tpanic(err)\n\t}\n", call)
+			if len(zeros) > 0 {
+				fmt.Fprintf(w, "\treturn %s\n", strings.Join(zeros, ", "))
+			}
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+}
+
+func (g *generator) writeServer(w *bytes.Buffer, name string, methods []method) {
+	rpc := g.use(rpcPath, "rpc")
+	fn := g.use(fnPath, "fn")
+
+	fmt.Fprintf(w, `
+// Register%[1]s registers a handler on m for each method of impl,
+// at selectors under prefix.
+func Register%[1]s(m *%[2]s.RespondMux, prefix string, impl %[1]s) {
+	if prefix != "" {
+		prefix += "."
+	}
+`, name, rpc)
+
+	for _, m := range methods {
+		var ptrs, args, rets []string
+		if m.hasCtx {
+			args = append(args, "c.Context")
+		}
+		for i := range m.params {
+			ptrs = append(ptrs, fmt.Sprintf("&a%d", i))
+			arg := fmt.Sprintf("a%d", i)
+			if m.sig.Variadic() && i == len(m.params)-1 {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+		if m.hasCall {
+			args = append(args, "c")
+		}
+		for i := range m.returns {
+			rets = append(rets, fmt.Sprintf("r%d", i))
+		}
+
+		fmt.Fprintf(w, "\tm.Handle(prefix+%q, %s.HandlerFunc(func(r %s.Responder, c *%s.Call) {\n", m.name, rpc, rpc, rpc)
+		for i, t := range m.params {
+			fmt.Fprintf(w, "\t\tvar a%d %s\n", i, g.typeString(t))
+		}
+		fmt.Fprintf(w, "\t\tif err := %s.DecodeArgs(c, %t%s); err != nil {\n\t\t\tr.Return(err)\n\t\t\treturn\n\t\t}\n", fn, m.sig.Variadic(), prefixed(", ", ptrs))
+		call := fmt.Sprintf("impl.%s(%s)", m.name, strings.Join(args, ", "))
+		lhs := rets
+		if m.returnErr {
+			lhs = append(lhs, "err")
+		}
+		if len(lhs) > 0 {
+			fmt.Fprintf(w, "\t\t%s := %s\n", strings.Join(lhs, ", "), call)
+		} else {
+			fmt.Fprintf(w, "\t\t%s\n", call)
+		}
+		if m.returnErr {
+			fmt.Fprintf(w, "\t\tif err != nil {\n\t\t\tr.Return(err)\n\t\t\treturn\n\t\t}\n")
+		}
+		fmt.Fprintf(w, "\t\tr.Return(%s)\n", strings.Join(rets, ", "))
+		fmt.Fprintf(w, "\t}))\n")
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// std reports whether path is the import path of a standard library package.
+func std(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+func resultList(results []string) string {
+	switch len(results) {
+	case 0:
+		return ""
+	case 1:
+		return results[0]
+	default:
+		return "(" + strings.Join(results, ", ") + ")"
+	}
+}
+
+func prefixed(sep string, s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return sep + strings.Join(s, sep)
+}
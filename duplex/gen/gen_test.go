@@ -0,0 +1,176 @@
+package gen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/fn"
+	"tractor.dev/toolkit-go/duplex/gen/testdata/calc"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/rpc/rpctest"
+)
+
+func fatal(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	src, err := Generate("testdata/calc", "Calculator")
+	fatal(t, err)
+	want, err := os.ReadFile("testdata/calc/calculator_duplex.go")
+	fatal(t, err)
+	if !bytes.Equal(src, want) {
+		t.Fatalf("generated source does not match testdata/calc/calculator_duplex.go, regenerate it with duplex gen:\n%s", src)
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, names := range [][]string{
+			nil,
+			{"Missing"},
+			{"Point"},
+		} {
+			if _, err := Generate("testdata/calc", names...); err == nil {
+				t.Fatalf("expected error for %v", names)
+			}
+		}
+	})
+}
+
+func TestGenerated(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			ctx := context.Background()
+
+			t.Run("client and server", func(t *testing.T) {
+				impl := &calc.Impl{}
+				m := rpc.NewRespondMux()
+				calc.RegisterCalculator(m, "calc", impl)
+				client, _ := rpctest.NewPair(m, cd)
+				defer client.Close()
+
+				c := fn.ClientFor[calc.Calculator](client, "calc")
+				sum, err := c.Add(ctx, 2, 3)
+				fatal(t, err)
+				if sum != 5 {
+					t.Fatalf("unexpected sum: %v", sum)
+				}
+				if _, err := c.Div(1, 0); err == nil || err.Error() != "remote: division by zero" {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if s := c.Join("-", "a", "b", "c"); s != "a-b-c" {
+					t.Fatalf("unexpected join: %v", s)
+				}
+				if p := c.Scale(calc.Point{X: 1, Y: 2}, 3); p != (calc.Point{X: 3, Y: 6}) {
+					t.Fatalf("unexpected point: %v", p)
+				}
+				c.Reset()
+				if impl.Resets != 1 {
+					t.Fatalf("unexpected resets: %v", impl.Resets)
+				}
+				if s := c.Selector(nil); s != "/calc/Selector" {
+					t.Fatalf("unexpected selector: %v", s)
+				}
+			})
+
+			t.Run("generated client with HandlerFrom", func(t *testing.T) {
+				impl := &calc.Impl{}
+				m := rpc.NewRespondMux()
+				m.Handle("calc", fn.HandlerFrom[calc.Calculator](impl))
+				client, _ := rpctest.NewPair(m, cd)
+				defer client.Close()
+
+				c := calc.NewCalculatorClient(client, "calc")
+				sum, err := c.Add(ctx, 2, 3)
+				fatal(t, err)
+				if sum != 5 {
+					t.Fatalf("unexpected sum: %v", sum)
+				}
+				if s := c.Join("-", "a", "b"); s != "a-b" {
+					t.Fatalf("unexpected join: %v", s)
+				}
+				q, err := c.Div(6, 4)
+				fatal(t, err)
+				if q != 1.5 {
+					t.Fatalf("unexpected quotient: %v", q)
+				}
+				if p := c.Scale(calc.Point{X: 1, Y: 2}, 2); p != (calc.Point{X: 2, Y: 4}) {
+					t.Fatalf("unexpected point: %v", p)
+				}
+				c.Reset()
+				if impl.Resets != 1 {
+					t.Fatalf("unexpected resets: %v", impl.Resets)
+				}
+			})
+
+			t.Run("ClientFor with generated server", func(t *testing.T) {
+				m := rpc.NewRespondMux()
+				calc.RegisterCalculator(m, "", &calc.Impl{})
+				client, _ := rpctest.NewPair(m, cd)
+				defer client.Close()
+
+				c := fn.ClientFor[struct {
+					Add   func(ctx context.Context, a, b int) (int, error)
+					Scale func(p calc.Point, n int) (calc.Point, error)
+				}](client, "")
+				sum, err := c.Add(ctx, 1, 2)
+				fatal(t, err)
+				if sum != 3 {
+					t.Fatalf("unexpected sum: %v", sum)
+				}
+				p, err := c.Scale(calc.Point{X: 2, Y: 3}, 2)
+				fatal(t, err)
+				if p != (calc.Point{X: 4, Y: 6}) {
+					t.Fatalf("unexpected point: %v", p)
+				}
+			})
+
+			t.Run("variadic args", func(t *testing.T) {
+				m := rpc.NewRespondMux()
+				calc.RegisterCalculator(m, "gen", &calc.Impl{})
+				m.Handle("fn", fn.HandlerFrom[calc.Calculator](&calc.Impl{}))
+				client, _ := rpctest.NewPair(m, cd)
+				defer client.Close()
+
+				for _, tc := range []struct {
+					args fn.Args
+					want string
+				}{
+					{fn.Args{"-"}, ""},
+					{fn.Args{"-", "a"}, "a"},
+					{fn.Args{"-", "a", "b", "c"}, "a-b-c"},
+					{fn.Args{"-", []string{"a", "b"}}, "a-b"},
+				} {
+					for _, prefix := range []string{"gen", "fn"} {
+						var s string
+						_, err := client.Call(ctx, prefix+".Join", tc.args, &s)
+						fatal(t, err)
+						if s != tc.want {
+							t.Fatalf("unexpected join from %s for %v: %q", prefix, tc.args, s)
+						}
+					}
+				}
+			})
+
+			t.Run("bad args", func(t *testing.T) {
+				m := rpc.NewRespondMux()
+				calc.RegisterCalculator(m, "", &calc.Impl{})
+				client, _ := rpctest.NewPair(m, cd)
+				defer client.Close()
+
+				_, err := client.Call(ctx, "Add", fn.Args{1})
+				var re rpc.RemoteError
+				if !errors.As(err, &re) {
+					t.Fatalf("expected remote error, got: %v", err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Package calc is used to test generated clients and servers.
+package calc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+//go:generate duplex gen . Calculator
+
+type Point struct {
+	X, Y int
+}
+
+type Calculator interface {
+	Add(ctx context.Context, a, b int) (int, error)
+	Div(a, b float64) (float64, error)
+	Join(sep string, parts ...string) string
+	Scale(p Point, n int) Point
+	Reset()
+	Selector(c *rpc.Call) string
+}
+
+type Impl struct {
+	Resets int
+}
+
+func (c *Impl) Add(ctx context.Context, a, b int) (int, error) {
+	if ctx == nil {
+		return 0, errors.New("no context")
+	}
+	return a + b, nil
+}
+
+func (c *Impl) Div(a, b float64) (float64, error) {
+	if b == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return a / b, nil
+}
+
+func (c *Impl) Join(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
+
+func (c *Impl) Scale(p Point, n int) Point {
+	return Point{X: p.X * n, Y: p.Y * n}
+}
+
+func (c *Impl) Reset() {
+	c.Resets++
+}
+
+func (c *Impl) Selector(call *rpc.Call) string {
+	return call.Selector()
+}
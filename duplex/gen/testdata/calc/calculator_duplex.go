@@ -0,0 +1,155 @@
+// Code generated by duplex gen. DO NOT EDIT.
+
+package calc
+
+import (
+	"context"
+
+	"tractor.dev/toolkit-go/duplex/fn"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// CalculatorClient implements Calculator by calling the methods of a remote Calculator.
+type CalculatorClient struct {
+	caller rpc.Caller
+	prefix string
+}
+
+// NewCalculatorClient returns a CalculatorClient calling the methods of a remote Calculator,
+// registered at prefix, with caller.
+func NewCalculatorClient(caller rpc.Caller, prefix string) *CalculatorClient {
+	return &CalculatorClient{caller: caller, prefix: prefix}
+}
+
+func init() {
+	fn.RegisterClient(func(caller rpc.Caller, prefix string) Calculator {
+		return NewCalculatorClient(caller, prefix)
+	})
+}
+
+func (c *CalculatorClient) selector(name string) string {
+	if c.prefix == "" {
+		return name
+	}
+	return c.prefix + "." + name
+}
+
+// Add calls "Add" on the remote Calculator.
+func (c *CalculatorClient) Add(ctx context.Context, a0 int, a1 int) (int, error) {
+	var r0 int
+	_, err := c.caller.Call(ctx, c.selector("Add"), fn.Args{a0, a1}, &r0)
+	return r0, err
+}
+
+// Div calls "Div" on the remote Calculator.
+func (c *CalculatorClient) Div(a0 float64, a1 float64) (float64, error) {
+	var r0 float64
+	_, err := c.caller.Call(context.Background(), c.selector("Div"), fn.Args{a0, a1}, &r0)
+	return r0, err
+}
+
+// Join calls "Join" on the remote Calculator.
+func (c *CalculatorClient) Join(a0 string, a1 ...string) string {
+	var r0 string
+	if _, err := c.caller.Call(context.Background(), c.selector("Join"), fn.Args{a0, a1}, &r0); err != nil {
+		panic(err)
+	}
+	return r0
+}
+
+// Reset calls "Reset" on the remote Calculator.
+func (c *CalculatorClient) Reset() {
+	if _, err := c.caller.Call(context.Background(), c.selector("Reset"), fn.Args{}); err != nil {
+		panic(err)
+	}
+}
+
+// Scale calls "Scale" on the remote Calculator.
+func (c *CalculatorClient) Scale(a0 Point, a1 int) Point {
+	var r0 Point
+	if _, err := c.caller.Call(context.Background(), c.selector("Scale"), fn.Args{a0, a1}, &r0); err != nil {
+		panic(err)
+	}
+	return r0
+}
+
+// Selector calls "Selector" on the remote Calculator.
+func (c *CalculatorClient) Selector(_ *rpc.Call) string {
+	var r0 string
+	if _, err := c.caller.Call(context.Background(), c.selector("Selector"), fn.Args{}, &r0); err != nil {
+		panic(err)
+	}
+	return r0
+}
+
+// RegisterCalculator registers a handler on m for each method of impl,
+// at selectors under prefix.
+func RegisterCalculator(m *rpc.RespondMux, prefix string, impl Calculator) {
+	if prefix != "" {
+		prefix += "."
+	}
+	m.Handle(prefix+"Add", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var a0 int
+		var a1 int
+		if err := fn.DecodeArgs(c, false, &a0, &a1); err != nil {
+			r.Return(err)
+			return
+		}
+		r0, err := impl.Add(c.Context, a0, a1)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(r0)
+	}))
+	m.Handle(prefix+"Div", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var a0 float64
+		var a1 float64
+		if err := fn.DecodeArgs(c, false, &a0, &a1); err != nil {
+			r.Return(err)
+			return
+		}
+		r0, err := impl.Div(a0, a1)
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(r0)
+	}))
+	m.Handle(prefix+"Join", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var a0 string
+		var a1 []string
+		if err := fn.DecodeArgs(c, true, &a0, &a1); err != nil {
+			r.Return(err)
+			return
+		}
+		r0 := impl.Join(a0, a1...)
+		r.Return(r0)
+	}))
+	m.Handle(prefix+"Reset", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		if err := fn.DecodeArgs(c, false); err != nil {
+			r.Return(err)
+			return
+		}
+		impl.Reset()
+		r.Return()
+	}))
+	m.Handle(prefix+"Scale", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var a0 Point
+		var a1 int
+		if err := fn.DecodeArgs(c, false, &a0, &a1); err != nil {
+			r.Return(err)
+			return
+		}
+		r0 := impl.Scale(a0, a1)
+		r.Return(r0)
+	}))
+	m.Handle(prefix+"Selector", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		if err := fn.DecodeArgs(c, false); err != nil {
+			r.Return(err)
+			return
+		}
+		r0 := impl.Selector(c)
+		r.Return(r0)
+	}))
+}
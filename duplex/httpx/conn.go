@@ -0,0 +1,125 @@
+package httpx
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+type addr uint32
+
+func (a addr) Network() string { return "duplex" }
+func (a addr) String() string  { return fmt.Sprintf("channel:%d", uint32(a)) }
+
+// conn adapts a mux.Channel to a net.Conn. Read deadlines are supported
+// by reading from the channel in the background, which lets an HTTP server
+// abort a pending read. Write deadlines are ignored.
+type conn struct {
+	ch mux.Channel
+
+	rmu     sync.Mutex
+	pending chan readResult // in-flight background read, if any
+	buf     []byte
+	err     error
+
+	dmu    sync.Mutex
+	expire chan struct{} // closed when the read deadline is exceeded
+	timer  *time.Timer
+}
+
+type readResult struct {
+	b   []byte
+	err error
+}
+
+// Conn returns a net.Conn for reading and writing to ch.
+func Conn(ch mux.Channel) net.Conn {
+	return &conn{
+		ch:     ch,
+		expire: make(chan struct{}),
+	}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	if len(c.buf) == 0 && c.err == nil {
+		if c.pending == nil {
+			res := make(chan readResult, 1)
+			go func(b []byte) {
+				n, err := c.ch.Read(b)
+				res <- readResult{b[:n], err}
+			}(make([]byte, len(p)))
+			c.pending = res
+		}
+		c.dmu.Lock()
+		expire := c.expire
+		c.dmu.Unlock()
+		select {
+		case r := <-c.pending:
+			c.pending = nil
+			c.buf, c.err = r.b, r.err
+		case <-expire:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	if len(c.buf) == 0 && c.err != nil {
+		return n, c.err
+	}
+	return n, nil
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	return c.ch.Write(p)
+}
+
+func (c *conn) Close() error {
+	return c.ch.Close()
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return addr(c.ch.ID())
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return addr(c.ch.ID())
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.dmu.Lock()
+	defer c.dmu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	expire := make(chan struct{})
+	c.expire = expire
+	if t.IsZero() {
+		return nil
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		close(expire)
+		return nil
+	}
+	c.timer = time.AfterFunc(d, func() {
+		close(expire)
+	})
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
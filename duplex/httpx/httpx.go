@@ -0,0 +1,140 @@
+// Package httpx tunnels HTTP over duplex sessions.
+//
+// Each request is carried over its own mux channel using HTTP/1.1 framing,
+// so streaming bodies, trailers and Upgrade requests work just as they would
+// over a TCP connection. Sessions can be dedicated to HTTP with NewTransport
+// and Serve, or HTTP can be served alongside RPC handlers on a peer with
+// NewCallerTransport and Handler.
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// NewTransport returns an http.Transport that sends each request over a new
+// channel opened on sess. Only the "http" scheme is supported and the host
+// in request URLs is ignored.
+func NewTransport(sess mux.Session) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			ch, err := sess.Open(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return Conn(ch), nil
+		},
+		DisableKeepAlives: true,
+	}
+}
+
+// NewCallerTransport returns an http.Transport that sends each request over
+// the channel of a call to selector, which should be handled by a Handler.
+// Only the "http" scheme is supported and the host in request URLs is ignored.
+func NewCallerTransport(caller rpc.Caller, selector string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			resp, err := caller.Call(ctx, selector, nil)
+			if err != nil {
+				return nil, err
+			}
+			return Conn(resp.Channel), nil
+		},
+		DisableKeepAlives: true,
+	}
+}
+
+// Serve accepts channels on sess and serves HTTP requests on them with h. It
+// returns nil when the session ends.
+func Serve(sess mux.Session, h http.Handler) error {
+	err := (&http.Server{Handler: h}).Serve(Listener(sess))
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Listener returns a net.Listener that accepts channels on sess as connections.
+// Closing the listener closes the session.
+func Listener(sess mux.Session) net.Listener {
+	return &sessionListener{sess}
+}
+
+type sessionListener struct {
+	sess mux.Session
+}
+
+func (l *sessionListener) Accept() (net.Conn, error) {
+	ch, err := l.sess.Accept()
+	if err != nil {
+		if err == io.EOF {
+			return nil, net.ErrClosed
+		}
+		return nil, err
+	}
+	return Conn(ch), nil
+}
+
+func (l *sessionListener) Close() error {
+	return l.sess.Close()
+}
+
+func (l *sessionListener) Addr() net.Addr {
+	return addr(0)
+}
+
+// Handler returns an rpc.Handler that serves HTTP requests with h over the
+// channel of each call it handles. This allows HTTP to be served on a session
+// that is also used for RPC, such as with a talk.Peer.
+func Handler(h http.Handler) rpc.Handler {
+	l := &connListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	go (&http.Server{Handler: h}).Serve(l)
+	return rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		if err := c.Receive(nil); err != nil {
+			r.Return(err)
+			return
+		}
+		ch, err := r.Continue(nil)
+		if err != nil {
+			return
+		}
+		l.conns <- Conn(ch)
+	})
+}
+
+// connListener is a net.Listener for connections sent to it.
+type connListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return addr(0)
+}
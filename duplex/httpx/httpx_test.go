@@ -0,0 +1,136 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/talk"
+)
+
+func fatal(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Hello world")
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Count")
+		n, _ := io.Copy(w, r.Body)
+		w.Header().Set("X-Count", strings.Repeat("*", int(n)))
+	})
+	mux.HandleFunc("/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		io.WriteString(conn, line)
+	})
+	return mux
+}
+
+func testClient(t *testing.T, client *http.Client) {
+	t.Run("get", func(t *testing.T) {
+		resp, err := client.Get("http://duplex/hello")
+		fatal(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		fatal(t, err)
+		if string(b) != "Hello world" {
+			t.Fatalf("unexpected body: %q", b)
+		}
+	})
+
+	t.Run("streaming body and trailer", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 3; i++ {
+				io.WriteString(pw, "data")
+			}
+			pw.Close()
+		}()
+		resp, err := client.Post("http://duplex/echo", "text/plain", pr)
+		fatal(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		fatal(t, err)
+		if string(b) != "datadatadata" {
+			t.Fatalf("unexpected body: %q", b)
+		}
+		if resp.Trailer.Get("X-Count") != strings.Repeat("*", 12) {
+			t.Fatalf("unexpected trailer: %v", resp.Trailer)
+		}
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "http://duplex/upgrade", nil)
+		fatal(t, err)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "echo")
+		resp, err := client.Do(req)
+		fatal(t, err)
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("unexpected status: %d", resp.StatusCode)
+		}
+		rw, ok := resp.Body.(io.ReadWriteCloser)
+		if !ok {
+			t.Fatal("expected writable body")
+		}
+		defer rw.Close()
+		_, err = io.WriteString(rw, "Hello upgrade\n")
+		fatal(t, err)
+		line, err := bufio.NewReader(rw).ReadString('\n')
+		fatal(t, err)
+		if line != "Hello upgrade\n" {
+			t.Fatalf("unexpected data: %q", line)
+		}
+	})
+}
+
+func TestSession(t *testing.T) {
+	a, b := mux.Pair()
+	defer a.Close()
+	defer b.Close()
+	go Serve(a, testHandler())
+
+	testClient(t, &http.Client{Transport: NewTransport(b)})
+}
+
+func TestPeer(t *testing.T) {
+	a, b := mux.Pair()
+	peerA := talk.NewPeer(a, codec.CBORCodec{})
+	peerB := talk.NewPeer(b, codec.CBORCodec{})
+	defer peerA.Close()
+	defer peerB.Close()
+	peerA.Handle("http", Handler(testHandler()))
+	go peerA.Respond()
+
+	testClient(t, &http.Client{Transport: NewCallerTransport(peerB, "http")})
+
+	// rpc calls still work alongside http on the session
+	peerA.Handle("ping", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		r.Return("pong")
+	}))
+	var ret string
+	_, err := peerB.Call(context.Background(), "ping", nil, &ret)
+	fatal(t, err)
+	if ret != "pong" {
+		t.Fatalf("unexpected return: %v", ret)
+	}
+}
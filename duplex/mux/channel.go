@@ -52,6 +52,9 @@ type channel struct {
 	// Pending internal channel messages.
 	msg chan frame.Message
 
+	// done is closed when the channel is torn down.
+	done chan struct{}
+
 	sentEOF bool
 
 	// thread-safe data
@@ -79,6 +82,12 @@ func (ch *channel) ID() uint32 {
 	return ch.localId
 }
 
+// Done returns a channel that is closed once the channel has been
+// closed by both sides or the session has ended.
+func (ch *channel) Done() <-chan struct{} {
+	return ch.done
+}
+
 // CloseWrite signals the end of sending data.
 // The other side may still send data
 func (ch *channel) CloseWrite() error {
@@ -172,6 +181,7 @@ func (c *channel) adjustWindow(n uint32) error {
 func (c *channel) close() {
 	c.pending.eof()
 	close(c.msg)
+	close(c.done)
 	c.writeMu.Lock()
 	// This is not necessary for a normal channel teardown, but if
 	// there was another error, it is.
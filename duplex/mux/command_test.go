@@ -0,0 +1,110 @@
+package mux
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess is not a real test. It is run as a subprocess by the
+// command tests to echo back data on channels opened over stdio.
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("MUX_HELPER_PROCESS") {
+	case "echo":
+		sess, _ := DialStdio()
+		for {
+			ch, err := sess.Accept()
+			if err != nil {
+				os.Exit(0)
+			}
+			go func() {
+				io.Copy(ch, ch)
+				ch.CloseWrite()
+			}()
+		}
+	case "exit":
+		os.Exit(0)
+	}
+}
+
+func helperCommand(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "MUX_HELPER_PROCESS="+mode)
+	return cmd
+}
+
+func testEcho(t *testing.T, sess Session) {
+	t.Helper()
+	ch, err := sess.Open(context.Background())
+	fatal(err, t)
+	_, err = io.WriteString(ch, "Hello world")
+	fatal(err, t)
+	fatal(ch.CloseWrite(), t)
+	b, err := io.ReadAll(ch)
+	fatal(err, t)
+	if string(b) != "Hello world" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+	ch.Close()
+}
+
+func TestDialCommand(t *testing.T) {
+	sess, err := DialCommand(helperCommand("echo"))
+	fatal(err, t)
+
+	testEcho(t, sess)
+
+	waited := make(chan error)
+	go func() {
+		waited <- sess.Wait()
+	}()
+	fatal(sess.Close(), t)
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return after close")
+	}
+}
+
+func TestDialCommandExit(t *testing.T) {
+	sess, err := DialCommand(helperCommand("exit"))
+	fatal(err, t)
+	defer sess.Close()
+
+	waited := make(chan error)
+	go func() {
+		waited <- sess.Wait()
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return after process exit")
+	}
+}
+
+func TestListenCommand(t *testing.T) {
+	l, err := ListenCommand(helperCommand("echo"))
+	fatal(err, t)
+
+	sess, err := l.Accept()
+	fatal(err, t)
+	testEcho(t, sess)
+
+	accepted := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		accepted <- err
+	}()
+	fatal(l.Close(), t)
+	select {
+	case err := <-accepted:
+		if err != io.EOF {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept did not return after close")
+	}
+}
@@ -0,0 +1,108 @@
+package mux
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// CommandTimeout is how long a command is given to exit after being
+// interrupted when its session is closed before it is killed.
+var CommandTimeout = 5 * time.Second
+
+// DialCommand starts cmd and establishes a mux session over its Stdin and Stdout,
+// which must not be set. If cmd.Stderr is nil, it is forwarded to os.Stderr.
+//
+// Wait on the returned session returns when either the process exits or the
+// session ends. Closing the session closes the process Stdin and sends it an
+// interrupt signal, killing it if it has not exited after CommandTimeout. Close
+// blocks until the process has exited.
+func DialCommand(cmd *exec.Cmd) (Session, error) {
+	return startCommand(cmd)
+}
+
+type cmdSession struct {
+	Session
+	cmd *exec.Cmd
+
+	exited  chan struct{}
+	exitErr error
+	once    sync.Once
+}
+
+func startCommand(cmd *exec.Cmd) (*cmdSession, error) {
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	// Use our own pipes instead of StdinPipe and StdoutPipe since exec.Cmd.Wait
+	// closes those when the process exits, possibly before we've read everything.
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, err
+	}
+
+	s := &cmdSession{
+		Session: New(&ioduplex{inW, outR}),
+		cmd:     cmd,
+		exited:  make(chan struct{}),
+	}
+	go func() {
+		s.exitErr = cmd.Wait()
+		close(s.exited)
+		s.Session.Close()
+	}()
+	return s, nil
+}
+
+// Wait blocks until either the process exits, returning its exit error,
+// or the session ends, returning the error causing the shutdown.
+func (s *cmdSession) Wait() error {
+	sessErr := make(chan error, 1)
+	go func() {
+		sessErr <- s.Session.Wait()
+	}()
+	select {
+	case <-s.exited:
+		return s.exitErr
+	case err := <-sessErr:
+		return err
+	}
+}
+
+// Close closes the session and stops the process, first by interrupting
+// and then killing it if it has not exited after CommandTimeout.
+func (s *cmdSession) Close() error {
+	s.once.Do(func() {
+		s.Session.Close()
+		if err := s.cmd.Process.Signal(os.Interrupt); err != nil {
+			// interrupt is not supported on all platforms
+			s.cmd.Process.Kill()
+		}
+		t := time.NewTimer(CommandTimeout)
+		defer t.Stop()
+		select {
+		case <-s.exited:
+		case <-t.C:
+			s.cmd.Process.Kill()
+			<-s.exited
+		}
+	})
+	return nil
+}
@@ -9,7 +9,7 @@ func dialNet(proto, addr string) (Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	return New(conn), nil
+	return New(wrapConn(conn)), nil
 }
 
 // DialTCP establishes a mux session via TCP connection.
@@ -0,0 +1,45 @@
+package mux
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrFilesUnsupported is returned when passing files over a session
+// whose transport does not support it.
+var ErrFilesUnsupported = errors.New("mux: transport does not support passing files")
+
+// FileSession is implemented by sessions that can pass open files to the
+// other side, such as sessions over Unix domain sockets on Unix systems.
+type FileSession interface {
+	Session
+
+	// SendFiles queues files to be sent along with the next data written to
+	// the session and returns IDs the other side can use to receive them.
+	// Files are duplicated when sent, so the caller can close them after
+	// that data is written.
+	SendFiles(files ...*os.File) ([]uint64, error)
+
+	// ReceiveFiles returns received files by their IDs. Each file can only be
+	// received once. Files that are never received are closed with the session.
+	ReceiveFiles(ids []uint64) ([]*os.File, error)
+}
+
+// fileTransport is implemented by transports able to pass files.
+type fileTransport interface {
+	sendFiles(files []*os.File) ([]uint64, error)
+	receiveFiles(ids []uint64) ([]*os.File, error)
+}
+
+type fileSession struct {
+	*session
+	t fileTransport
+}
+
+func (s *fileSession) SendFiles(files ...*os.File) ([]uint64, error) {
+	return s.t.sendFiles(files)
+}
+
+func (s *fileSession) ReceiveFiles(ids []uint64) ([]*os.File, error) {
+	return s.t.receiveFiles(ids)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package mux
+
+import (
+	"io"
+	"net"
+)
+
+// wrapConn returns conn as a transport. Passing files is not supported.
+func wrapConn(conn net.Conn) io.ReadWriteCloser {
+	return conn
+}
@@ -0,0 +1,153 @@
+//go:build unix
+
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// maxFiles is the most files that can be sent with a single write,
+// matching SCM_MAX_FD on Linux.
+const maxFiles = 253
+
+// wrapConn returns a transport for conn, which for Unix domain
+// sockets also supports passing files.
+func wrapConn(conn net.Conn) io.ReadWriteCloser {
+	if uc, ok := conn.(*net.UnixConn); ok {
+		return &unixTransport{
+			UnixConn: uc,
+			received: make(map[uint64]*os.File),
+			oob:      make([]byte, syscall.CmsgSpace(maxFiles*4)),
+		}
+	}
+	return conn
+}
+
+// unixTransport passes files as SCM_RIGHTS control messages along with data
+// written to a Unix domain socket. Files are identified by the order they
+// were sent, which is the order they are received.
+type unixTransport struct {
+	*net.UnixConn
+
+	wmu      sync.Mutex
+	outgoing []*os.File
+	sent     uint64
+
+	rmu      sync.Mutex
+	received map[uint64]*os.File
+	nrecv    uint64
+	oob      []byte
+}
+
+func (t *unixTransport) sendFiles(files []*os.File) ([]uint64, error) {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	if len(t.outgoing)+len(files) > maxFiles {
+		return nil, fmt.Errorf("mux: too many files queued to send, max is %d", maxFiles)
+	}
+	ids := make([]uint64, len(files))
+	for i := range files {
+		ids[i] = t.sent
+		t.sent++
+	}
+	t.outgoing = append(t.outgoing, files...)
+	return ids, nil
+}
+
+func (t *unixTransport) receiveFiles(ids []uint64) ([]*os.File, error) {
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	files := make([]*os.File, len(ids))
+	for i, id := range ids {
+		f, ok := t.received[id]
+		if !ok {
+			return nil, fmt.Errorf("mux: file %d not received", id)
+		}
+		files[i] = f
+	}
+	for _, id := range ids {
+		delete(t.received, id)
+	}
+	return files, nil
+}
+
+func (t *unixTransport) Write(p []byte) (int, error) {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	if len(t.outgoing) == 0 || len(p) == 0 {
+		return t.UnixConn.Write(p)
+	}
+
+	fds := make([]int, len(t.outgoing))
+	for i, f := range t.outgoing {
+		// use SyscallConn instead of Fd to avoid putting the file in blocking mode
+		rc, err := f.SyscallConn()
+		if err != nil {
+			return 0, err
+		}
+		rc.Control(func(fd uintptr) {
+			fds[i] = int(fd)
+		})
+	}
+	n, _, err := t.UnixConn.WriteMsgUnix(p, syscall.UnixRights(fds...), nil)
+	if err != nil {
+		return n, err
+	}
+	t.outgoing = nil
+	if n < len(p) {
+		nn, err := t.UnixConn.Write(p[n:])
+		return n + nn, err
+	}
+	return n, nil
+}
+
+func (t *unixTransport) Read(p []byte) (int, error) {
+	n, oobn, flags, _, err := t.UnixConn.ReadMsgUnix(p, t.oob)
+	if oobn > 0 {
+		if perr := t.parseRights(t.oob[:oobn]); perr != nil {
+			return n, perr
+		}
+	}
+	if flags&syscall.MSG_CTRUNC != 0 {
+		return n, errors.New("mux: received files were truncated")
+	}
+	return n, err
+}
+
+func (t *unixTransport) parseRights(oob []byte) error {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return err
+	}
+	t.rmu.Lock()
+	defer t.rmu.Unlock()
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			return err
+		}
+		for _, fd := range fds {
+			syscall.CloseOnExec(fd)
+			t.received[t.nrecv] = os.NewFile(uintptr(fd), fmt.Sprintf("fd:%d", fd))
+			t.nrecv++
+		}
+	}
+	return nil
+}
+
+// Close closes the connection and any files received but not claimed.
+func (t *unixTransport) Close() error {
+	t.rmu.Lock()
+	for id, f := range t.received {
+		f.Close()
+		delete(t.received, id)
+	}
+	t.rmu.Unlock()
+	return t.UnixConn.Close()
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package mux
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestUnixFiles(t *testing.T) {
+	sockPath := path.Join(t.TempDir(), "qmux.sock")
+	l, err := ListenUnix(sockPath)
+	fatal(err, t)
+	defer l.Close()
+
+	accepted := make(chan Session, 1)
+	go func() {
+		sess, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		if _, err := sess.Accept(); err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- sess
+	}()
+
+	sess, err := DialUnix(sockPath)
+	fatal(err, t)
+	defer sess.Close()
+	fs, ok := sess.(FileSession)
+	if !ok {
+		t.Fatal("expected unix session to be a FileSession")
+	}
+
+	r, w, err := os.Pipe()
+	fatal(err, t)
+	defer r.Close()
+
+	ids, err := fs.SendFiles(w)
+	fatal(err, t)
+	ch, err := sess.Open(context.Background())
+	fatal(err, t)
+	w.Close()
+	ch.Close()
+
+	remote := <-accepted
+	if remote == nil {
+		t.Fatal("accept failed")
+	}
+	defer remote.Close()
+
+	files, err := remote.(FileSession).ReceiveFiles(ids)
+	fatal(err, t)
+	if len(files) != 1 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	_, err = io.WriteString(files[0], "Hello world")
+	fatal(err, t)
+	files[0].Close()
+
+	b, err := io.ReadAll(r)
+	fatal(err, t)
+	if string(b) != "Hello world" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+
+	if _, err := remote.(FileSession).ReceiveFiles(ids); err == nil {
+		t.Fatal("expected error receiving file twice")
+	}
+}
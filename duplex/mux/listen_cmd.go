@@ -0,0 +1,78 @@
+package mux
+
+import (
+	"io"
+	"net"
+	"os/exec"
+	"sync"
+)
+
+// cmdListener starts a command on first Accept to use as a listener.
+type cmdListener struct {
+	cmd *exec.Cmd
+
+	mu       sync.Mutex
+	sess     *cmdSession
+	accepted bool
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// Accept starts the command and returns a session over its Stdin and Stdout
+// the first time it is called. Later calls block until the command exits or
+// the listener is closed and then return io.EOF.
+func (l *cmdListener) Accept() (Session, error) {
+	l.mu.Lock()
+	if !l.accepted {
+		l.accepted = true
+		sess, err := startCommand(l.cmd)
+		if err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+		l.sess = sess
+		l.mu.Unlock()
+		return sess, nil
+	}
+	sess := l.sess
+	l.mu.Unlock()
+
+	var exited chan struct{}
+	if sess != nil {
+		exited = sess.exited
+	}
+	select {
+	case <-exited:
+	case <-l.closed:
+	}
+	return nil, io.EOF
+}
+
+// Close closes the listener and the session for the command if started.
+func (l *cmdListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	l.mu.Lock()
+	sess := l.sess
+	l.mu.Unlock()
+	if sess != nil {
+		return sess.Close()
+	}
+	return nil
+}
+
+func (l *cmdListener) Addr() net.Addr {
+	return nil
+}
+
+// ListenCommand returns a Listener that starts cmd and returns a session over its
+// Stdin and Stdout when first accepted. The session behaves like one returned from
+// DialCommand. This lets you serve a command over its stdio, for example using
+// rpc.Server.ServeMux, which will return once the command has exited.
+func ListenCommand(cmd *exec.Cmd) (Listener, error) {
+	return &cmdListener{
+		cmd:    cmd,
+		closed: make(chan struct{}),
+	}, nil
+}
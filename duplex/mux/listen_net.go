@@ -15,7 +15,7 @@ func (l *netListener) Accept() (Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	return New(conn), nil
+	return New(wrapConn(conn)), nil
 }
 
 // Close closes the listener.
@@ -69,6 +69,9 @@ func New(t io.ReadWriteCloser) Session {
 		closeCh: make(chan bool, 1),
 	}
 	go s.loop()
+	if ft, ok := t.(fileTransport); ok {
+		return &fileSession{session: s, t: ft}
+	}
 	return s
 }
 
@@ -142,6 +145,7 @@ func (s *session) newChannel(direction channelDirection) *channel {
 		pending:   newBuffer(),
 		direction: direction,
 		msg:       make(chan frame.Message, chanSize),
+		done:      make(chan struct{}),
 		session:   s,
 		packetBuf: make([]byte, 0),
 	}
@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+// AuthenticateSelector is the selector used to authenticate a session.
+const AuthenticateSelector = "rpc.authenticate"
+
+// Exchange sends and receives values between the two sides authenticating a session.
+type Exchange interface {
+	Send(v any) error
+	Receive(v any) error
+}
+
+// Authenticator authenticates sessions on the responding side, exchanging values
+// with the Credentials of the calling side. It returns an identity for the caller
+// that handlers can get with Call.Identity, or an error to refuse the session.
+type Authenticator interface {
+	Authenticate(ctx context.Context, ex Exchange) (identity any, err error)
+}
+
+// The AuthenticatorFunc type is an adapter to allow the use of ordinary functions as Authenticators.
+type AuthenticatorFunc func(ctx context.Context, ex Exchange) (any, error)
+
+// Authenticate calls f(ctx, ex).
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, ex Exchange) (any, error) {
+	return f(ctx, ex)
+}
+
+// Credentials authenticate a session on the calling side, exchanging values
+// with the Authenticator of the responding side.
+type Credentials interface {
+	Authenticate(ctx context.Context, ex Exchange) error
+}
+
+// The CredentialsFunc type is an adapter to allow the use of ordinary functions as Credentials.
+type CredentialsFunc func(ctx context.Context, ex Exchange) error
+
+// Authenticate calls f(ctx, ex).
+func (f CredentialsFunc) Authenticate(ctx context.Context, ex Exchange) error {
+	return f(ctx, ex)
+}
+
+// Authenticate authenticates the session of the client with a Server using an
+// Authenticator. It should be called before making any other calls, which the
+// Server refuses with ErrUnauthenticated until authentication succeeds.
+func Authenticate(ctx context.Context, c *Client, creds Credentials) error {
+	resp, err := c.Call(ctx, AuthenticateSelector, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if !resp.Continue() {
+		return fmt.Errorf("rpc: unexpected response to %s", AuthenticateSelector)
+	}
+	if err := creds.Authenticate(ctx, resp); err != nil {
+		return err
+	}
+	var status Response
+	if err := resp.Receive(&status.ResponseHeader); err != nil {
+		return err
+	}
+	return status.remoteError()
+}
+
+type identityKey struct{}
+
+// IdentityFrom returns the identity of an authenticated caller
+// from the context of a Call, or nil if there is none.
+func IdentityFrom(ctx context.Context) any {
+	return ctx.Value(identityKey{})
+}
+
+// Identity returns the identity of the caller returned by the Server
+// Authenticator, or nil if the Server has no Authenticator.
+func (c *Call) Identity() any {
+	if c.Context == nil {
+		return nil
+	}
+	return IdentityFrom(c.Context)
+}
+
+// DefaultAuthTimeout is how long a session has to authenticate
+// when the Server does not set AuthTimeout.
+const DefaultAuthTimeout = 10 * time.Second
+
+// authenticate accepts channels from sess until it gets a call to AuthenticateSelector,
+// then uses the Authenticator with it. Other calls are refused with ErrUnauthenticated,
+// one at a time. If sess is not authenticated within AuthTimeout, it is closed.
+// It returns ctx with the identity from the Authenticator.
+func (s *Server) authenticate(sess mux.Session, ctx context.Context) (context.Context, error) {
+	timeout := s.AuthTimeout
+	if timeout == 0 {
+		timeout = DefaultAuthTimeout
+	}
+	authCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stop := context.AfterFunc(authCtx, func() {
+		sess.Close()
+	})
+	identity, err := s.acceptAuthenticate(sess, authCtx)
+	if !stop() {
+		if authCtx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%w: timed out authenticating", ErrUnauthenticated)
+		}
+		if err == nil {
+			err = authCtx.Err()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, identityKey{}, identity), nil
+}
+
+// acceptAuthenticate accepts channels from sess until it gets a call to
+// AuthenticateSelector, returning the identity from the Authenticator.
+func (s *Server) acceptAuthenticate(sess mux.Session, ctx context.Context) (any, error) {
+	for {
+		ch, err := sess.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		framer := &FrameCodec{Codec: s.Codec}
+		dec := framer.Decoder(ch)
+		var call Call
+		if err := dec.Decode(&call); err != nil {
+			log.Println("rpc.Respond:", err)
+			ch.Close()
+			continue
+		}
+		resp := &responder{
+			ch:     ch,
+			c:      framer,
+			header: &ResponseHeader{},
+			sess:   sess,
+		}
+		if cleanSelector(call.S) != cleanSelector(AuthenticateSelector) {
+			resp.Return(fmt.Errorf("%w: %s called before authenticating", ErrUnauthenticated, call.S))
+			ch.Close()
+			continue
+		}
+
+		call.Decoder = dec
+		if err := call.Receive(nil); err != nil {
+			ch.Close()
+			return nil, err
+		}
+		if _, err := resp.Continue(nil); err != nil {
+			ch.Close()
+			return nil, err
+		}
+		identity, err := s.Authenticator.Authenticate(ctx, exchange{resp, &call})
+		status := &responder{ch: ch, c: framer, header: &ResponseHeader{}}
+		if err != nil {
+			if !errors.Is(err, ErrUnauthenticated) {
+				err = fmt.Errorf("%w: %s", ErrUnauthenticated, err)
+			}
+			status.setError(err)
+			if status.Send(status.header) == nil {
+				lingerClose(ch)
+			}
+			ch.Close()
+			return nil, err
+		}
+		if err := status.Send(status.header); err != nil {
+			ch.Close()
+			return nil, err
+		}
+		ch.Close()
+		return identity, nil
+	}
+}
+
+type exchange struct {
+	r Responder
+	c *Call
+}
+
+func (e exchange) Send(v any) error {
+	return e.r.Send(v)
+}
+
+func (e exchange) Receive(v any) error {
+	return e.c.Receive(v)
+}
+
+// authLinger is how long to wait for the caller to receive a failed
+// authentication status before the session is closed.
+const authLinger = time.Second
+
+// lingerClose waits for the caller to close ch or for authLinger.
+func lingerClose(ch mux.Channel) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ch)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(authLinger):
+	}
+}
@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	password := CredentialsFunc(func(ctx context.Context, ex Exchange) error {
+		return ex.Send("secret")
+	})
+	wrongPassword := CredentialsFunc(func(ctx context.Context, ex Exchange) error {
+		return ex.Send("wrong")
+	})
+
+	newPair := func(timeout time.Duration) (*Client, chan error) {
+		sessA, sessB := mux.Pair()
+		srv := &Server{
+			Codec:       codec.JSONCodec{},
+			AuthTimeout: timeout,
+			Handler: HandlerFunc(func(r Responder, c *Call) {
+				r.Return(c.Identity())
+			}),
+			Authenticator: AuthenticatorFunc(func(ctx context.Context, ex Exchange) (any, error) {
+				var pass string
+				if err := ex.Receive(&pass); err != nil {
+					return nil, err
+				}
+				if pass != "secret" {
+					return nil, errors.New("wrong password")
+				}
+				return "alice", nil
+			}),
+		}
+		responded := make(chan error, 1)
+		go func() {
+			responded <- srv.Respond(sessA, nil)
+		}()
+		return NewClient(sessB, codec.JSONCodec{}), responded
+	}
+
+	t.Run("authenticated", func(t *testing.T) {
+		client, _ := newPair(0)
+		defer client.Close()
+
+		_, err := client.Call(ctx, "whoami", nil)
+		if !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected unauthenticated error: %v", err)
+		}
+
+		fatal(t, Authenticate(ctx, client, password))
+		var identity string
+		_, err = client.Call(ctx, "whoami", nil, &identity)
+		fatal(t, err)
+		if identity != "alice" {
+			t.Fatalf("unexpected identity: %v", identity)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		client, responded := newPair(0)
+		defer client.Close()
+
+		err := Authenticate(ctx, client, wrongPassword)
+		if !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected unauthenticated error: %v", err)
+		}
+		if err := <-responded; !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("unexpected respond error: %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client, responded := newPair(20 * time.Millisecond)
+		defer client.Close()
+
+		select {
+		case err := <-responded:
+			if !errors.Is(err, ErrUnauthenticated) {
+				t.Fatalf("unexpected respond error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected session to be closed")
+		}
+	})
+}
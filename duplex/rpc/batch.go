@@ -0,0 +1,377 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+// BatchSelector is the selector batches are sent to by Batch.
+const BatchSelector = "rpc.batch"
+
+// batchCall is a call sent in a batch.
+type batchCall struct {
+	S string // Selector
+	P any    // Params
+}
+
+// batchResult is the response to a call sent in a batch.
+type batchResult struct {
+	H ResponseHeader // Header
+	V []any          // Values
+}
+
+// Batch collects calls to send to the remote side in a single call to BatchSelector,
+// saving a round-trip for each call. The remote side responds to the calls concurrently,
+// so calls sent together should not depend on each other, unless they are pipelined
+// using a Promise. A Batch is sent once.
+//
+//	b := rpc.NewBatch(client)
+//	user := b.Call("users.get", fn.Args{id}, &u)
+//	orders := b.Call("orders.list", fn.Args{user}, &o) // user is replaced by its result
+//	if err := b.Send(ctx); err != nil {
+//		return err
+//	}
+//	if err := orders.Err(); err != nil {
+//		return err
+//	}
+type Batch struct {
+	caller   Caller
+	calls    []batchCall
+	promises []*Promise
+	sent     bool
+}
+
+// NewBatch returns a Batch that is sent with caller.
+func NewBatch(caller Caller) *Batch {
+	return &Batch{caller: caller}
+}
+
+// Call adds a call to selector with params to the batch, returning a Promise for its
+// result, which will be decoded into reply when the batch is sent. The Promise can be
+// used in the params of later calls in the same batch, where it is replaced by the
+// first value returned to it before the call is handled.
+func (b *Batch) Call(selector string, params any, reply ...any) *Promise {
+	p := &Promise{Index: len(b.promises), reply: reply}
+	b.calls = append(b.calls, batchCall{S: selector, P: params})
+	b.promises = append(b.promises, p)
+	return p
+}
+
+// Send sends the calls in the batch and waits for their responses. It returns an error
+// if the batch could not be sent or handled, in which case each Promise has the same
+// error. Otherwise errors returned for each call are returned by the Err of its Promise.
+func (b *Batch) Send(ctx context.Context) error {
+	if b.sent {
+		return errors.New("rpc: batch already sent")
+	}
+	b.sent = true
+	if len(b.calls) == 0 {
+		return nil
+	}
+
+	var results []batchResult
+	resp, err := b.caller.Call(ctx, BatchSelector, b.calls, &results)
+	if err == nil && len(results) != len(b.promises) {
+		err = fmt.Errorf("rpc: batch of %d calls got %d results", len(b.promises), len(results))
+	}
+	if err != nil {
+		for _, p := range b.promises {
+			p.err = err
+		}
+		return err
+	}
+	var cd codec.Codec
+	if resp != nil {
+		cd = resp.codec
+	}
+	for i, p := range b.promises {
+		p.resolve(cd, results[i])
+	}
+	return nil
+}
+
+// Promise is the eventual result of a call added to a Batch. It is resolved when
+// the Batch is sent. Until then, it can be used as a param of later calls in the
+// Batch to pipeline the result of the call into them.
+type Promise struct {
+	// Index is the position of the call in the Batch, and is all that is encoded
+	// for the Promise when it is used as a param.
+	Index int `json:"$result"`
+
+	reply []any
+	resp  *Response
+	err   error
+}
+
+// Err returns the error of the call, if any, once the Batch is sent.
+func (p *Promise) Err() error {
+	return p.err
+}
+
+// Response returns the Response of the call once the Batch is sent. It has no
+// Channel, since responses in a batch can not be continued.
+func (p *Promise) Response() *Response {
+	return p.resp
+}
+
+// resolve sets the response and error from the result, decoding its values into the reply.
+func (p *Promise) resolve(cd codec.Codec, r batchResult) {
+	p.resp = &Response{ResponseHeader: r.H, codec: cd}
+	if len(p.reply) == 1 {
+		p.resp.Value = p.reply[0]
+	} else if len(p.reply) > 1 {
+		p.resp.Value = p.reply
+	}
+	if p.err = p.resp.remoteError(); p.err != nil {
+		return
+	}
+	for i, reply := range p.reply {
+		if i >= len(r.V) {
+			break
+		}
+		if p.err = recode(cd, r.V[i], reply); p.err != nil {
+			return
+		}
+	}
+}
+
+// recode decodes the value v into the pointer ptr by encoding it with cd,
+// or with mapstructure if there is no codec, using json tags like the codecs.
+func recode(cd codec.Codec, v, ptr any) error {
+	if cd == nil {
+		dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			TagName: "json",
+			Squash:  true,
+			Result:  ptr,
+		})
+		if err != nil {
+			return err
+		}
+		return dec.Decode(v)
+	}
+	var buf bytes.Buffer
+	if err := cd.Encoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	return cd.Decoder(&buf).Decode(ptr)
+}
+
+// batchConcurrency is the most calls in a batch that are handled at once.
+const batchConcurrency = 16
+
+// BatchHandler returns a handler for batches sent by Batch, which responds to each
+// call in the batch with h in its own goroutine, handling up to 16 at once. Calls
+// that use the result of an earlier call wait for it, and fail if it failed. It is
+// usually registered on the RespondMux handling the calls:
+//
+//	mux.Handle(rpc.BatchSelector, rpc.BatchHandler(mux))
+//
+// When the Server has Limits, each call in the batch counts against them instead of
+// the batch itself, so calls over the limits are queued or fail like any other.
+//
+// The calls share the context and metadata of the batch call. Handlers responding
+// to them are unable to continue responses, and their Call has no channel to read.
+func BatchHandler(h Handler) Handler {
+	return HandlerFunc(func(r Responder, c *Call) {
+		resp, ok := baseResponder(r)
+		if !ok {
+			r.Return(errors.New("rpc: unable to batch with responder"))
+			return
+		}
+		var calls []batchCall
+		if err := c.Receive(&calls); err != nil {
+			r.Return(err)
+			return
+		}
+		lim := resp.lim
+		resp.releaseLimit()
+
+		results := make([]batchResult, len(calls))
+		done := make([]chan struct{}, len(calls))
+		for i := range done {
+			done[i] = make(chan struct{})
+		}
+		// calls are started in order, so those waiting for the
+		// result of an earlier call never hold up the earlier call
+		sem := make(chan struct{}, batchConcurrency)
+		var wg sync.WaitGroup
+		for i, bc := range calls {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int, bc batchCall) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				defer close(done[i])
+				br := &batchResponder{}
+				params, err := resolveParams(bc.P, i, results, done)
+				if err == nil && lim != nil {
+					selector := cleanSelector(bc.S)
+					if err = lim.acquire(c.Context, selector); err == nil {
+						defer lim.release(selector)
+					}
+				}
+				if err == nil {
+					err = respondBatched(h, br, c, resp.c, bc.S, params)
+				}
+				if err != nil {
+					br.header.setError(err)
+				}
+				results[i] = batchResult{H: br.header, V: br.values}
+			}(i, bc)
+		}
+		wg.Wait()
+		r.Return(results)
+	})
+}
+
+// respondBatched responds to a call in a batch with h, using cd to decode its params.
+func respondBatched(h Handler, br *batchResponder, c *Call, cd codec.Codec, selector string, params any) error {
+	var buf bytes.Buffer
+	if err := cd.Encoder(&buf).Encode(params); err != nil {
+		return err
+	}
+	call := &Call{
+		CallHeader: CallHeader{S: cleanSelector(selector), M: c.M},
+		Caller:     c.Caller,
+		Decoder:    cd.Decoder(&buf),
+		Context:    c.Context,
+		Channel:    batchChannel{},
+	}
+	h.RespondRPC(br, call)
+	if !br.responded {
+		br.Return()
+	}
+	return nil
+}
+
+// resolveParams returns v with the promises it contains replaced by the first
+// value returned to the calls they are for, which must come before the call
+// at index i, waiting for the calls to finish.
+func resolveParams(v any, i int, results []batchResult, done []chan struct{}) (any, error) {
+	switch vv := v.(type) {
+	case []any:
+		out := make([]any, len(vv))
+		for j, e := range vv {
+			var err error
+			if out[j], err = resolveParams(e, i, results, done); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[string]any:
+		if idx, ok := promiseIndex(len(vv), vv["$result"]); ok {
+			return resolvePromise(idx, i, results, done)
+		}
+		out := make(map[string]any, len(vv))
+		for k, e := range vv {
+			var err error
+			if out[k], err = resolveParams(e, i, results, done); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case map[any]any:
+		if idx, ok := promiseIndex(len(vv), vv["$result"]); ok {
+			return resolvePromise(idx, i, results, done)
+		}
+		out := make(map[any]any, len(vv))
+		for k, e := range vv {
+			var err error
+			if out[k], err = resolveParams(e, i, results, done); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// promiseIndex returns the index of an encoded Promise, given the length
+// of a decoded map and its "$result" value.
+func promiseIndex(n int, v any) (int, bool) {
+	if n != 1 {
+		return 0, false
+	}
+	switch idx := v.(type) {
+	case float64:
+		return int(idx), idx == float64(int(idx))
+	case uint64:
+		return int(idx), true
+	case int64:
+		return int(idx), true
+	default:
+		return 0, false
+	}
+}
+
+func resolvePromise(idx, i int, results []batchResult, done []chan struct{}) (any, error) {
+	if idx < 0 || idx >= i {
+		return nil, fmt.Errorf("%w: call %d uses result of call %d", ErrInvalidArgument, i, idx)
+	}
+	<-done[idx]
+	r := results[idx]
+	if r.H.E != nil {
+		return nil, fmt.Errorf("call %d failed: %s", idx, *r.H.E)
+	}
+	if len(r.V) == 0 {
+		return nil, nil
+	}
+	return r.V[0], nil
+}
+
+// batchResponder records the response to a call in a batch.
+type batchResponder struct {
+	header    ResponseHeader
+	values    []any
+	responded bool
+}
+
+func (r *batchResponder) Return(v ...any) error {
+	r.responded = true
+	if len(v) == 1 {
+		if e, ok := v[0].(error); ok {
+			r.header.setError(e)
+			v = []any{nil}
+		}
+	}
+	if len(v) == 0 {
+		v = []any{nil}
+	}
+	r.values = v
+	return nil
+}
+
+func (r *batchResponder) Continue(v ...any) (mux.Channel, error) {
+	err := errors.New("rpc: unable to continue response in batch")
+	r.Return(err)
+	return batchChannel{}, err
+}
+
+func (r *batchResponder) Send(v interface{}) error {
+	return errors.New("rpc: unable to send in batch")
+}
+
+func (r *batchResponder) Header() Metadata {
+	if r.header.M == nil {
+		r.header.M = Metadata{}
+	}
+	return r.header.M
+}
+
+// batchChannel is the channel of calls in a batch, which is already closed.
+type batchChannel struct{}
+
+func (batchChannel) Read(p []byte) (int, error)  { return 0, io.EOF }
+func (batchChannel) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+func (batchChannel) Close() error                { return nil }
+func (batchChannel) CloseWrite() error           { return nil }
+func (batchChannel) ID() uint32                  { return 0 }
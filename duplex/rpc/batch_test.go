@@ -0,0 +1,220 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+)
+
+type batchUser struct {
+	ID   int
+	Name string
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewRespondMux()
+	m.Handle(BatchSelector, BatchHandler(m))
+	m.Handle("user", HandlerFunc(func(r Responder, c *Call) {
+		var id int
+		fatal(t, c.Receive(&id))
+		r.Return(batchUser{ID: id, Name: fmt.Sprintf("user%d", id)})
+	}))
+	m.Handle("greet", HandlerFunc(func(r Responder, c *Call) {
+		var args []batchUser
+		if err := c.Receive(&args); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Header().Set("greeted", args[0].Name)
+		r.Return("hello " + args[0].Name)
+	}))
+	m.Handle("slow", HandlerFunc(func(r Responder, c *Call) {
+		c.Receive(nil)
+		time.Sleep(50 * time.Millisecond)
+		r.Return("slow")
+	}))
+	m.Handle("fail", HandlerFunc(func(r Responder, c *Call) {
+		c.Receive(nil)
+		r.Return(fmt.Errorf("%w: no user", ErrNotFound))
+	}))
+	m.Handle("stream", HandlerFunc(func(r Responder, c *Call) {
+		c.Receive(nil)
+		r.Continue()
+	}))
+
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		sessA, sessB := pipeSessions()
+		srv := &Server{Codec: cd, Handler: m}
+		go srv.Respond(sessA, nil)
+		client := NewClient(sessB, cd)
+
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			t.Run("calls", func(t *testing.T) {
+				var user batchUser
+				var s1, s2 string
+				b := NewBatch(client)
+				p1 := b.Call("user", 1, &user)
+				p2 := b.Call("slow", nil, &s1)
+				p3 := b.Call("slow", nil, &s2)
+				p4 := b.Call("fail", nil)
+				p5 := b.Call("missing", nil)
+				start := time.Now()
+				fatal(t, b.Send(ctx))
+				if time.Since(start) > 90*time.Millisecond {
+					t.Fatal("expected calls to be handled concurrently")
+				}
+				fatal(t, p1.Err())
+				fatal(t, p2.Err())
+				fatal(t, p3.Err())
+				if user != (batchUser{ID: 1, Name: "user1"}) || s1 != "slow" || s2 != "slow" {
+					t.Fatalf("unexpected replies: %v %v %v", user, s1, s2)
+				}
+				if !errors.Is(p4.Err(), ErrNotFound) || p4.Err().Error() != "remote: not found: no user" {
+					t.Fatalf("unexpected error: %v", p4.Err())
+				}
+				if !errors.Is(p5.Err(), ErrNotFound) {
+					t.Fatalf("unexpected error: %v", p5.Err())
+				}
+				if err := b.Send(ctx); err == nil {
+					t.Fatal("expected error sending batch again")
+				}
+			})
+
+			t.Run("pipelining", func(t *testing.T) {
+				var greeting string
+				b := NewBatch(client)
+				user := b.Call("user", 2)
+				greet := b.Call("greet", []any{user}, &greeting)
+				failed := b.Call("greet", []any{b.Call("fail", nil)})
+				fatal(t, b.Send(ctx))
+				fatal(t, user.Err())
+				fatal(t, greet.Err())
+				if greeting != "hello user2" {
+					t.Fatalf("unexpected greeting: %v", greeting)
+				}
+				if v := greet.Response().M.Get("greeted"); v != "user2" {
+					t.Fatalf("unexpected metadata: %v", v)
+				}
+				if failed.Err() == nil {
+					t.Fatal("expected error using result of failed call")
+				}
+			})
+
+			t.Run("bad promise", func(t *testing.T) {
+				b := NewBatch(client)
+				p := &Promise{Index: 1}
+				bad := b.Call("greet", []any{p})
+				b.Call("user", 3)
+				fatal(t, b.Send(ctx))
+				if !errors.Is(bad.Err(), ErrInvalidArgument) {
+					t.Fatalf("unexpected error: %v", bad.Err())
+				}
+			})
+
+			t.Run("continue", func(t *testing.T) {
+				b := NewBatch(client)
+				p := b.Call("stream", nil)
+				fatal(t, b.Send(ctx))
+				if p.Err() == nil {
+					t.Fatal("expected error continuing response")
+				}
+			})
+
+			t.Run("unhandled", func(t *testing.T) {
+				m := NewRespondMux()
+				client, _ := newTestPair(m)
+				defer client.Close()
+				b := NewBatch(client)
+				p := b.Call("user", 1)
+				if err := b.Send(ctx); !errors.Is(err, ErrNotFound) || !errors.Is(p.Err(), ErrNotFound) {
+					t.Fatalf("unexpected errors: %v %v", err, p.Err())
+				}
+			})
+		})
+		client.Close()
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// counting returns a mux handling batches and "count", which records the
+	// most calls to it handled at once in most.
+	counting := func(most *int64) *RespondMux {
+		var active int64
+		m := NewRespondMux()
+		m.Handle(BatchSelector, BatchHandler(m))
+		m.Handle("count", HandlerFunc(func(r Responder, c *Call) {
+			c.Receive(nil)
+			n := atomic.AddInt64(&active, 1)
+			for {
+				old := atomic.LoadInt64(most)
+				if n <= old || atomic.CompareAndSwapInt64(most, old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&active, -1)
+			r.Return(nil)
+		}))
+		return m
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		var most int64
+		client := newLimitedPair(Limits{MaxConcurrent: 1, Queue: true}, counting(&most))
+		defer client.Close()
+		b := NewBatch(client)
+		for i := 0; i < 4; i++ {
+			b.Call("count", nil)
+		}
+		fatal(t, b.Send(ctx))
+		if n := atomic.LoadInt64(&most); n != 1 {
+			t.Fatalf("expected calls to be handled one at a time, got %d at once", n)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		var most int64
+		// one token for the batch and two for its calls
+		client := newLimitedPair(Limits{Rate: 1, Burst: 3}, counting(&most))
+		defer client.Close()
+		b := NewBatch(client)
+		var promises []*Promise
+		for i := 0; i < 3; i++ {
+			promises = append(promises, b.Call("count", nil))
+		}
+		b.Send(ctx)
+		var rejected int
+		for _, p := range promises {
+			if errors.Is(p.Err(), ErrResourceExhausted) {
+				rejected++
+			}
+		}
+		if rejected != 1 {
+			t.Fatalf("expected 1 call to be rejected, got %d", rejected)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		var most int64
+		client := newLimitedPair(Limits{}, counting(&most))
+		defer client.Close()
+		b := NewBatch(client)
+		for i := 0; i < 4*batchConcurrency; i++ {
+			b.Call("count", nil)
+		}
+		fatal(t, b.Send(ctx))
+		if n := atomic.LoadInt64(&most); n > batchConcurrency {
+			t.Fatalf("expected at most %d calls at once, got %d", batchConcurrency, n)
+		}
+	})
+}
@@ -2,20 +2,13 @@ package rpc
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"time"
 
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
 )
 
-// RemoteError is an error that has been returned from
-// the remote side of the RPC connection.
-type RemoteError string
-
-func (e RemoteError) Error() string {
-	return fmt.Sprintf("remote: %s", string(e))
-}
-
 // Client wraps a session and codec to make RPC calls over the session.
 type Client struct {
 	mux.Session
@@ -33,7 +26,8 @@ func NewClient(session mux.Session, codec codec.Codec) *Client {
 // Call makes synchronous calls to the remote selector passing args and putting the reply
 // value in reply. Both args and reply can be nil. Args can be a channel of interface{}
 // values for asynchronously streaming multiple values from another goroutine, however
-// the call will still block until a response is sent. If there is an error making the call
+// the call will still block until a response is sent. Once the channel is closed, the
+// end of the stream is signalled to the handler with CloseWrite. If there is an error making the call
 // an error is returned, and if an error is returned by the remote handler a RemoteError
 // is returned.
 //
@@ -56,22 +50,55 @@ func (c *Client) Call(ctx context.Context, selector string, args any, reply ...a
 		case <-done:
 		}
 	}()
-	resp, err := call(ctx, ch, c.codec, selector, args, reply...)
+	header := CallHeader{
+		S: selector,
+		T: timeoutFrom(ctx),
+		M: metadataFrom(ctx),
+	}
+	if files := filesFrom(ctx); len(files) > 0 {
+		header.F, err = sendFiles(c.Session, files)
+		if err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+	resp, err := call(ctx, ch, c.codec, header, args, reply...)
+	if resp != nil {
+		resp.sess = c.Session
+	}
 	if ctxErr := ctx.Err(); ctxErr != nil {
 		return resp, ctxErr
 	}
+	var re RemoteError
+	if deadline, ok := ctx.Deadline(); ok && err != nil && !errors.As(err, &re) && !time.Now().Before(deadline) {
+		// the remote side gave up at the deadline before ctx was cancelled
+		return resp, context.DeadlineExceeded
+	}
 	return resp, err
 }
 
-func call(ctx context.Context, ch mux.Channel, cd codec.Codec, selector string, args any, reply ...any) (*Response, error) {
+// timeoutFrom returns the milliseconds left before the deadline of ctx,
+// or zero if it has none. It rounds up so the remote side never gives up
+// before the caller, and an expired deadline is still sent as one.
+func timeoutFrom(ctx context.Context) int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	ms := (time.Until(deadline) + time.Millisecond - 1).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return ms
+}
+
+func call(ctx context.Context, ch mux.Channel, cd codec.Codec, header CallHeader, args any, reply ...any) (*Response, error) {
 	framer := &FrameCodec{Codec: cd}
 	enc := framer.Encoder(ch)
 	dec := framer.Decoder(ch)
 
 	// request
-	err := enc.Encode(CallHeader{
-		S: selector,
-	})
+	err := enc.Encode(header)
 	if err != nil {
 		ch.Close()
 		return nil, err
@@ -86,6 +113,10 @@ func call(ctx context.Context, ch mux.Channel, cd codec.Codec, selector string,
 				return nil, err
 			}
 		}
+		if err := ch.CloseWrite(); err != nil {
+			ch.Close()
+			return nil, err
+		}
 	default:
 		if err := enc.Encode(args); err != nil {
 			ch.Close()
@@ -94,19 +125,19 @@ func call(ctx context.Context, ch mux.Channel, cd codec.Codec, selector string,
 	}
 
 	// response
-	var header ResponseHeader
-	err = dec.Decode(&header)
+	var respHeader ResponseHeader
+	err = dec.Decode(&respHeader)
 	if err != nil {
 		ch.Close()
 		return nil, err
 	}
 
-	if !header.C {
+	if !respHeader.C {
 		defer ch.Close()
 	}
 
 	resp := &Response{
-		ResponseHeader: header,
+		ResponseHeader: respHeader,
 		Channel:        ch,
 		codec:          framer,
 	}
@@ -115,8 +146,8 @@ func call(ctx context.Context, ch mux.Channel, cd codec.Codec, selector string,
 	} else if len(reply) > 1 {
 		resp.Value = reply
 	}
-	if resp.Err() != nil {
-		return resp, RemoteError(resp.Err().Error())
+	if err := resp.remoteError(); err != nil {
+		return resp, err
 	}
 
 	if resp.Value == nil {
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+)
+
+// Codes for the errors registered by default.
+const (
+	CodeNotFound          = "not_found"
+	CodePermissionDenied  = "permission_denied"
+	CodeInvalidArgument   = "invalid_argument"
+	CodeUnavailable       = "unavailable"
+	CodeResourceExhausted = "resource_exhausted"
+	CodeUnauthenticated   = "unauthenticated"
+)
+
+// Sentinel errors registered by default. Handlers can return them, or errors
+// wrapping them, and callers can check for them with errors.Is.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrInvalidArgument   = errors.New("invalid argument")
+	ErrUnavailable       = errors.New("unavailable")
+	ErrResourceExhausted = errors.New("resource exhausted")
+	ErrUnauthenticated   = errors.New("unauthenticated")
+)
+
+// RemoteError is an error that has been returned from
+// the remote side of the RPC connection.
+//
+// Code is set when the handler returned an error matching a sentinel
+// registered with RegisterError on the responding side, in which case
+// errors.Is will match the sentinel registered for that code on the
+// calling side. Handlers can also return a RemoteError to set Code
+// and Details directly.
+type RemoteError struct {
+	Code    string         `json:",omitempty"`
+	Message string         `json:",omitempty"`
+	Details map[string]any `json:",omitempty"`
+}
+
+func (e RemoteError) Error() string {
+	return "remote: " + e.Message
+}
+
+// Is reports whether target is the sentinel error registered for the code of e.
+func (e RemoteError) Is(target error) bool {
+	if e.Code == "" {
+		return false
+	}
+	sentinel := lookupError(e.Code)
+	return sentinel != nil && sentinel == target
+}
+
+type registeredError struct {
+	code string
+	err  error
+}
+
+var errorRegistry struct {
+	sync.RWMutex
+	errs []registeredError
+}
+
+func init() {
+	RegisterError(CodeNotFound, ErrNotFound)
+	RegisterError(CodePermissionDenied, ErrPermissionDenied)
+	RegisterError(CodeInvalidArgument, ErrInvalidArgument)
+	RegisterError(CodeUnavailable, ErrUnavailable)
+	RegisterError(CodeResourceExhausted, ErrResourceExhausted)
+	RegisterError(CodeUnauthenticated, ErrUnauthenticated)
+}
+
+// RegisterError registers a sentinel error for code so it round-trips
+// through RemoteError. Both sides of a connection should register the
+// same codes. If code is already registered, RegisterError panics.
+func RegisterError(code string, err error) {
+	errorRegistry.Lock()
+	defer errorRegistry.Unlock()
+	if code == "" || err == nil {
+		panic("rpc: invalid error registration")
+	}
+	for _, e := range errorRegistry.errs {
+		if e.code == code {
+			panic("rpc: multiple registrations for error code " + code)
+		}
+	}
+	errorRegistry.errs = append(errorRegistry.errs, registeredError{code, err})
+}
+
+func lookupError(code string) error {
+	errorRegistry.RLock()
+	defer errorRegistry.RUnlock()
+	for _, e := range errorRegistry.errs {
+		if e.code == code {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// RemoteErrorFrom returns the RemoteError a responder sends for err, with the
+// code of the registered error it wraps, if any. It is for handlers reporting
+// errors to callers some other way than returning them.
+func RemoteErrorFrom(err error) RemoteError {
+	var re RemoteError
+	if errors.As(err, &re) {
+		return re
+	}
+	re.Message = err.Error()
+	errorRegistry.RLock()
+	errs := errorRegistry.errs
+	errorRegistry.RUnlock()
+	for _, e := range errs {
+		if errors.Is(err, e.err) {
+			re.Code = e.code
+			break
+		}
+	}
+	return re
+}
@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+func init() {
+	RegisterError("test_quota_exceeded", errQuotaExceeded)
+}
+
+func TestRemoteError(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewRespondMux()
+	m.Handle("missing", HandlerFunc(func(r Responder, c *Call) {
+		r.Return(fmt.Errorf("user 42: %w", ErrNotFound))
+	}))
+	m.Handle("quota", HandlerFunc(func(r Responder, c *Call) {
+		r.Return(errQuotaExceeded)
+	}))
+	m.Handle("details", HandlerFunc(func(r Responder, c *Call) {
+		r.Return(RemoteError{
+			Code:    CodeInvalidArgument,
+			Message: "bad name",
+			Details: map[string]any{"field": "name"},
+		})
+	}))
+	m.Handle("plain", HandlerFunc(func(r Responder, c *Call) {
+		r.Return(fmt.Errorf("plain"))
+	}))
+
+	for _, cd := range []codec.Codec{codec.JSONCodec{}, codec.CBORCodec{}} {
+		sessA, sessB := mux.Pair()
+		srv := &Server{Codec: cd, Handler: m}
+		go srv.Respond(sessA, nil)
+		client := NewClient(sessB, cd)
+
+		t.Run(fmt.Sprintf("%T", cd), func(t *testing.T) {
+			_, err := client.Call(ctx, "missing", nil)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected not found: %v", err)
+			}
+			if err.Error() != "remote: user 42: not found" {
+				t.Fatalf("unexpected message: %v", err)
+			}
+
+			_, err = client.Call(ctx, "quota", nil)
+			if !errors.Is(err, errQuotaExceeded) || errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected quota exceeded: %v", err)
+			}
+
+			_, err = client.Call(ctx, "details", nil)
+			var re RemoteError
+			if !errors.As(err, &re) {
+				t.Fatalf("expected remote error: %v", err)
+			}
+			if re.Code != CodeInvalidArgument || re.Message != "bad name" || re.Details["field"] != "name" {
+				t.Fatalf("unexpected remote error: %#v", re)
+			}
+			if !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("expected invalid argument: %v", err)
+			}
+
+			_, err = client.Call(ctx, "plain", nil)
+			re, ok := err.(RemoteError)
+			if !ok || re.Code != "" || re.Message != "plain" {
+				t.Fatalf("unexpected error: %#v", err)
+			}
+		})
+		client.Close()
+	}
+}
+
+func TestRemoteErrorOldPeer(t *testing.T) {
+	// a response header from a peer that only sends E
+	msg := "not found: /baz"
+	resp := &Response{ResponseHeader: ResponseHeader{E: &msg}}
+	err := resp.remoteError()
+	if err.Error() != "remote: not found: /baz" || errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+
+	// the header sent to a peer that only reads E still has the message
+	r := &responder{header: &ResponseHeader{}, ch: nopChannel{}, c: &FrameCodec{Codec: codec.JSONCodec{}}}
+	r.Return(fmt.Errorf("%w: /baz", ErrNotFound))
+	if r.header.E == nil || *r.header.E != "not found: /baz" {
+		t.Fatalf("unexpected header: %#v", r.header)
+	}
+	if r.header.X == nil || r.header.X.Code != CodeNotFound {
+		t.Fatalf("unexpected header: %#v", r.header)
+	}
+}
+
+type nopChannel struct{}
+
+func (nopChannel) Read(p []byte) (int, error)  { return 0, nil }
+func (nopChannel) Write(p []byte) (int, error) { return len(p), nil }
+func (nopChannel) Close() error                { return nil }
+func (nopChannel) CloseWrite() error           { return nil }
+func (nopChannel) ID() uint32                  { return 0 }
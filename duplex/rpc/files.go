@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+type filesKey struct{}
+
+// WithFiles returns a copy of ctx that attaches files to calls made with it.
+// Files can only be passed over sessions that implement mux.FileSession, such
+// as those from mux.DialUnix or mux.ListenUnix on Unix systems. The responding
+// side receives them using Files on the Call.
+func WithFiles(ctx context.Context, files ...*os.File) context.Context {
+	return context.WithValue(ctx, filesKey{}, files)
+}
+
+func filesFrom(ctx context.Context) []*os.File {
+	files, _ := ctx.Value(filesKey{}).([]*os.File)
+	return files
+}
+
+// AttachFiles attaches files to the response sent by a handler. It must be
+// called before Return or Continue. The calling side receives them using
+// Files on the Response.
+func AttachFiles(r Responder, files ...*os.File) error {
+	resp, ok := baseResponder(r)
+	if !ok {
+		return errors.New("rpc: unable to attach files to responder")
+	}
+	ids, err := sendFiles(resp.sess, files)
+	if err != nil {
+		return err
+	}
+	resp.header.F = append(resp.header.F, ids...)
+	return nil
+}
+
+// Files receives the files attached to the call by the caller.
+func (c *Call) Files() ([]*os.File, error) {
+	return receiveFiles(c.sess, c.F)
+}
+
+// Files receives the files attached to the response by the handler.
+func (r *Response) Files() ([]*os.File, error) {
+	return receiveFiles(r.sess, r.F)
+}
+
+func sendFiles(sess mux.Session, files []*os.File) ([]uint64, error) {
+	fs, ok := sess.(mux.FileSession)
+	if !ok {
+		return nil, mux.ErrFilesUnsupported
+	}
+	return fs.SendFiles(files...)
+}
+
+func receiveFiles(sess mux.Session, ids []uint64) ([]*os.File, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	fs, ok := sess.(mux.FileSession)
+	if !ok {
+		return nil, mux.ErrFilesUnsupported
+	}
+	return fs.ReceiveFiles(ids)
+}
@@ -0,0 +1,109 @@
+//go:build unix
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+func newUnixTestPair(t *testing.T, handler Handler) *Client {
+	sockPath := path.Join(t.TempDir(), "rpc.sock")
+	l, err := mux.ListenUnix(sockPath)
+	fatal(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		sess, err := l.Accept()
+		if err != nil {
+			return
+		}
+		srv := &Server{
+			Codec:   codec.JSONCodec{},
+			Handler: handler,
+		}
+		srv.Respond(sess, nil)
+	}()
+
+	sess, err := mux.DialUnix(sockPath)
+	fatal(t, err)
+	t.Cleanup(func() { sess.Close() })
+	return NewClient(sess, codec.JSONCodec{})
+}
+
+func TestFiles(t *testing.T) {
+	client := newUnixTestPair(t, HandlerFunc(func(r Responder, c *Call) {
+		files, err := c.Files()
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		for _, f := range files {
+			io.WriteString(f, "Hello from handler")
+			f.Close()
+		}
+
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		defer pr.Close()
+		io.WriteString(pw, "Hello from response")
+		pw.Close()
+		if err := AttachFiles(r, pr); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(len(files))
+	}))
+
+	pr, pw, err := os.Pipe()
+	fatal(t, err)
+	defer pr.Close()
+
+	var n int
+	ctx := WithFiles(context.Background(), pw)
+	resp, err := client.Call(ctx, "files", nil, &n)
+	fatal(t, err)
+	pw.Close()
+	if n != 1 {
+		t.Fatalf("unexpected return: %d", n)
+	}
+
+	b, err := io.ReadAll(pr)
+	fatal(t, err)
+	if string(b) != "Hello from handler" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+
+	files, err := resp.Files()
+	fatal(t, err)
+	if len(files) != 1 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	defer files[0].Close()
+	b, err = io.ReadAll(files[0])
+	fatal(t, err)
+	if string(b) != "Hello from response" {
+		t.Fatalf("unexpected data: %q", b)
+	}
+}
+
+func TestFilesUnsupported(t *testing.T) {
+	client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+		r.Return(nil)
+	}))
+	ctx := WithFiles(context.Background(), os.Stdin)
+	_, err := client.Call(ctx, "files", nil)
+	if !errors.Is(err, mux.ErrFilesUnsupported) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -30,7 +30,7 @@ func (f HandlerFunc) RespondRPC(resp Responder, call *Call) {
 // NotFoundHandler returns a simple handler that returns an error "not found".
 func NotFoundHandler() Handler {
 	return HandlerFunc(func(r Responder, c *Call) {
-		r.Return(fmt.Errorf("not found: %s", c.Selector()))
+		r.Return(fmt.Errorf("%w: %s", ErrNotFound, c.Selector()))
 	})
 }
 
@@ -50,6 +50,7 @@ func NotFoundHandler() Handler {
 type RespondMux struct {
 	m  map[string]muxEntry
 	es []muxEntry // slice of entries sorted from longest to shortest.
+	mw []Middleware
 	mu sync.RWMutex
 }
 
@@ -95,7 +96,7 @@ func (m *RespondMux) Handler(c *Call) (h Handler, pattern string) {
 
 	h, pattern = m.Match(c.Selector())
 	if h == nil {
-		h, pattern = NotFoundHandler(), ""
+		h, pattern = Chain(NotFoundHandler(), m.mw...), ""
 	}
 	return
 }
@@ -108,6 +109,12 @@ func (m *RespondMux) Remove(selector string) (h Handler) {
 	selector = cleanSelector(selector)
 	h = m.m[selector].h
 	delete(m.m, selector)
+	for i, e := range m.es {
+		if e.pattern == selector {
+			m.es = append(m.es[:i], m.es[i+1:]...)
+			break
+		}
+	}
 
 	return
 }
@@ -115,8 +122,17 @@ func (m *RespondMux) Remove(selector string) (h Handler) {
 // Match finds a handler given a selector string.
 // Most-specific (longest) pattern wins. If a pattern handler
 // is a submux, it will call Match with the selector minus the
-// pattern.
+// pattern. The returned handler is wrapped with any middleware
+// added with Use.
 func (m *RespondMux) Match(selector string) (h Handler, pattern string) {
+	h, pattern = m.match(selector)
+	if h != nil {
+		h = Chain(h, m.mw...)
+	}
+	return
+}
+
+func (m *RespondMux) match(selector string) (h Handler, pattern string) {
 	selector = cleanSelector(selector)
 
 	// Check for exact match first.
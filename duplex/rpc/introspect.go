@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"sort"
+	"strings"
+)
+
+// IntrospectSelector is the selector Introspect registers its handler at.
+const IntrospectSelector = "rpc.introspect"
+
+// SelectorInfo describes a selector pattern registered on a RespondMux.
+//
+// Selectors use the dot form "foo.bar", with patterns matching any selector
+// with a prefix ending in ".*". Params and Returns are Go type names, only
+// set for handlers implementing Describer such as those from fn.HandlerFrom.
+type SelectorInfo struct {
+	Selector string
+	Params   []string `json:",omitempty"`
+	Returns  []string `json:",omitempty"`
+}
+
+// Describer is implemented by handlers able to describe the types
+// of the values they take and return.
+type Describer interface {
+	Describe() (params, returns []string)
+}
+
+// Introspect registers a handler on m at IntrospectSelector that
+// returns the SelectorInfo for every pattern registered on m.
+func Introspect(m *RespondMux) {
+	m.Handle(IntrospectSelector, HandlerFunc(func(r Responder, c *Call) {
+		c.Receive(nil)
+		r.Return(m.Selectors())
+	}))
+}
+
+// Selectors returns the SelectorInfo for every pattern registered on m, including
+// patterns registered on sub RespondMuxes, sorted by selector.
+func (m *RespondMux) Selectors() []SelectorInfo {
+	var infos []SelectorInfo
+	m.Walk(func(selector string, h Handler) {
+		info := SelectorInfo{Selector: selector}
+		if d, ok := h.(Describer); ok {
+			info.Params, info.Returns = d.Describe()
+		}
+		infos = append(infos, info)
+	})
+	return infos
+}
+
+// Walk calls fn with the selector and handler of every pattern registered on m,
+// including patterns registered on sub RespondMuxes, sorted by selector. The
+// selectors are in the same form as SelectorInfo. Handlers are not wrapped with
+// middleware added with Use.
+func (m *RespondMux) Walk(fn func(selector string, h Handler)) {
+	entries := m.entries("/")
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].pattern < entries[j].pattern
+	})
+	for _, e := range entries {
+		fn(e.pattern, e.h)
+	}
+}
+
+// entries returns the entries registered on m and its sub RespondMuxes,
+// with patterns in dot form.
+func (m *RespondMux) entries(prefix string) []muxEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []muxEntry
+	for _, e := range m.m {
+		pattern := prefix + strings.TrimPrefix(e.pattern, "/")
+		if sub, ok := e.h.(*RespondMux); ok {
+			entries = append(entries, sub.entries(pattern)...)
+			continue
+		}
+		entries = append(entries, muxEntry{h: e.h, pattern: dotSelector(pattern)})
+	}
+	return entries
+}
+
+// dotSelector returns the dot form of the clean selector pattern s.
+func dotSelector(s string) string {
+	s = strings.ReplaceAll(strings.TrimPrefix(s, "/"), "/", ".")
+	if s == "" || strings.HasSuffix(s, ".") {
+		s += "*"
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIntrospect(t *testing.T) {
+	noop := HandlerFunc(func(r Responder, c *Call) {})
+
+	sub := NewRespondMux()
+	sub.Handle("bar", noop)
+	sub.Handle("baz.", noop)
+
+	m := NewRespondMux()
+	m.Handle("foo", sub)
+	m.Handle("hello", noop)
+	m.Handle("", noop)
+	Introspect(m)
+
+	client, _ := newTestPair(m)
+	defer client.Close()
+
+	var infos []SelectorInfo
+	_, err := client.Call(context.Background(), IntrospectSelector, nil, &infos)
+	fatal(t, err)
+
+	var selectors []string
+	for _, info := range infos {
+		selectors = append(selectors, info.Selector)
+	}
+	expected := []string{"*", "foo.bar", "foo.baz.*", "hello", "rpc.introspect"}
+	if len(selectors) != len(expected) {
+		t.Fatalf("unexpected selectors: %v", selectors)
+	}
+	for i := range expected {
+		if selectors[i] != expected[i] {
+			t.Fatalf("unexpected selectors: %v", selectors)
+		}
+	}
+}
+
+func TestRespondMuxWalk(t *testing.T) {
+	bar := HandlerFunc(func(r Responder, c *Call) {})
+	hello := HandlerFunc(func(r Responder, c *Call) {})
+
+	sub := NewRespondMux()
+	sub.Handle("bar", bar)
+
+	m := NewRespondMux()
+	m.Handle("foo", sub)
+	m.Handle("hello", hello)
+
+	var selectors []string
+	var handlers []Handler
+	m.Walk(func(selector string, h Handler) {
+		selectors = append(selectors, selector)
+		handlers = append(handlers, h)
+	})
+	if len(selectors) != 2 || selectors[0] != "foo.bar" || selectors[1] != "hello" {
+		t.Fatalf("unexpected selectors: %v", selectors)
+	}
+	if len(handlers) != 2 || handlers[0] == nil || handlers[1] == nil {
+		t.Fatalf("unexpected handlers: %v", handlers)
+	}
+}
@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits configures limits applied by a Server to the calls of each session.
+// The zero value applies no limits.
+type Limits struct {
+	// MaxConcurrent is the most calls handled at once per session.
+	// Zero means no limit.
+	MaxConcurrent int
+
+	// MaxConcurrentPerSelector is the most calls to the same selector
+	// handled at once per session. Zero means no limit.
+	MaxConcurrentPerSelector int
+
+	// Rate is the average number of calls per second allowed per session,
+	// allowing bursts of up to Burst calls. Zero means no limit.
+	Rate  float64
+	Burst int
+
+	// Queue makes calls over a limit wait until they can be handled instead of
+	// being rejected with ErrResourceExhausted. Queued calls are still rejected
+	// if their context ends while waiting.
+	Queue bool
+}
+
+func (l Limits) enabled() bool {
+	return l.MaxConcurrent > 0 || l.MaxConcurrentPerSelector > 0 || l.Rate > 0
+}
+
+// limiter enforces Limits for a single session.
+type limiter struct {
+	Limits
+
+	mu        sync.Mutex
+	active    int
+	selectors map[string]int
+	released  chan struct{} // closed and replaced when a call is released
+	tokens    float64
+	last      time.Time
+}
+
+func newLimiter(limits Limits) *limiter {
+	if !limits.enabled() {
+		return nil
+	}
+	return &limiter{
+		Limits:    limits,
+		selectors: make(map[string]int),
+		released:  make(chan struct{}),
+	}
+}
+
+// acquire waits for or rejects a call to selector according to the limits.
+// If it returns nil, release must be called once the call is handled.
+func (l *limiter) acquire(ctx context.Context, selector string) error {
+	if err := l.take(ctx); err != nil {
+		return err
+	}
+	for {
+		l.mu.Lock()
+		if (l.MaxConcurrent <= 0 || l.active < l.MaxConcurrent) &&
+			(l.MaxConcurrentPerSelector <= 0 || l.selectors[selector] < l.MaxConcurrentPerSelector) {
+			l.active++
+			l.selectors[selector]++
+			l.mu.Unlock()
+			return nil
+		}
+		if !l.Queue {
+			l.mu.Unlock()
+			return fmt.Errorf("%w: too many concurrent calls", ErrResourceExhausted)
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *limiter) release(selector string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.selectors[selector]--
+	if l.selectors[selector] <= 0 {
+		delete(l.selectors, selector)
+	}
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// take takes a token from the bucket, waiting for one if queueing.
+func (l *limiter) take(ctx context.Context) error {
+	if l.Rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	burst := float64(max(l.Burst, 1))
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*l.Rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if !l.Queue {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: rate limit exceeded", ErrResourceExhausted)
+	}
+	// reserve the next token and wait until it is available
+	wait := time.Duration((1 - l.tokens) / l.Rate * float64(time.Second))
+	l.tokens--
+	l.mu.Unlock()
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+func newLimitedPair(limits Limits, handler Handler) *Client {
+	sessA, sessB := mux.Pair()
+	srv := &Server{
+		Codec:   codec.JSONCodec{},
+		Handler: handler,
+		Limits:  limits,
+	}
+	go srv.Respond(sessA, nil)
+	return NewClient(sessB, codec.JSONCodec{})
+}
+
+func blockingMux(started chan string, release chan struct{}) *RespondMux {
+	m := NewRespondMux()
+	block := HandlerFunc(func(r Responder, c *Call) {
+		started <- c.Selector()
+		<-release
+		r.Return(nil)
+	})
+	m.Handle("a", block)
+	m.Handle("b", block)
+	return m
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("concurrent reject", func(t *testing.T) {
+		started := make(chan string, 2)
+		release := make(chan struct{})
+		client := newLimitedPair(Limits{MaxConcurrent: 1}, blockingMux(started, release))
+		defer client.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.Call(ctx, "a", nil)
+			done <- err
+		}()
+		<-started
+
+		_, err := client.Call(ctx, "b", nil)
+		if !errors.Is(err, ErrResourceExhausted) {
+			t.Fatalf("expected resource exhausted: %v", err)
+		}
+		close(release)
+		fatal(t, <-done)
+		_, err = client.Call(ctx, "b", nil)
+		fatal(t, err)
+	})
+
+	t.Run("per selector reject", func(t *testing.T) {
+		started := make(chan string, 2)
+		release := make(chan struct{})
+		client := newLimitedPair(Limits{MaxConcurrentPerSelector: 1}, blockingMux(started, release))
+		defer client.Close()
+
+		done := make(chan error, 2)
+		go func() {
+			_, err := client.Call(ctx, "a", nil)
+			done <- err
+		}()
+		<-started
+		go func() {
+			_, err := client.Call(ctx, "b", nil)
+			done <- err
+		}()
+		<-started
+
+		_, err := client.Call(ctx, "a", nil)
+		if !errors.Is(err, ErrResourceExhausted) {
+			t.Fatalf("expected resource exhausted: %v", err)
+		}
+		close(release)
+		fatal(t, <-done)
+		fatal(t, <-done)
+	})
+
+	t.Run("concurrent queue", func(t *testing.T) {
+		started := make(chan string, 2)
+		release := make(chan struct{})
+		client := newLimitedPair(Limits{MaxConcurrent: 1, Queue: true}, blockingMux(started, release))
+		defer client.Close()
+
+		done := make(chan error, 2)
+		for _, sel := range []string{"a", "b"} {
+			go func(sel string) {
+				_, err := client.Call(ctx, sel, nil)
+				done <- err
+			}(sel)
+		}
+		<-started
+		select {
+		case <-started:
+			t.Fatal("second call was not queued")
+		case <-time.After(50 * time.Millisecond):
+		}
+		release <- struct{}{}
+		<-started
+		close(release)
+		fatal(t, <-done)
+		fatal(t, <-done)
+	})
+
+	t.Run("queued call deadline", func(t *testing.T) {
+		started := make(chan string, 1)
+		release := make(chan struct{})
+		client := newLimitedPair(Limits{MaxConcurrent: 1, Queue: true}, blockingMux(started, release))
+		defer client.Close()
+		defer close(release)
+
+		go client.Call(ctx, "a", nil)
+		<-started
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := client.Call(ctx, "b", nil)
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected deadline exceeded: %v", err)
+		}
+	})
+
+	t.Run("rate reject", func(t *testing.T) {
+		client := newLimitedPair(Limits{Rate: 1, Burst: 2}, HandlerFunc(func(r Responder, c *Call) {
+			r.Return(nil)
+		}))
+		defer client.Close()
+
+		for i := 0; i < 2; i++ {
+			_, err := client.Call(ctx, "", nil)
+			fatal(t, err)
+		}
+		_, err := client.Call(ctx, "", nil)
+		if !errors.Is(err, ErrResourceExhausted) {
+			t.Fatalf("expected resource exhausted: %v", err)
+		}
+	})
+
+	t.Run("rate queue", func(t *testing.T) {
+		client := newLimitedPair(Limits{Rate: 20, Burst: 1, Queue: true}, HandlerFunc(func(r Responder, c *Call) {
+			r.Return(nil)
+		}))
+		defer client.Close()
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := client.Call(ctx, "", nil)
+			fatal(t, err)
+		}
+		if d := time.Since(start); d < 90*time.Millisecond {
+			t.Fatalf("calls were not rate limited: %v", d)
+		}
+	})
+}
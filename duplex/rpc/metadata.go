@@ -0,0 +1,47 @@
+package rpc
+
+import "context"
+
+// Metadata holds key-value pairs sent alongside a call or response, such as
+// auth tokens, trace IDs or locale.
+type Metadata map[string]string
+
+// Get returns the value for key, or an empty string if it is not set.
+func (md Metadata) Get(key string) string {
+	return md[key]
+}
+
+// Set sets the value for key.
+func (md Metadata) Set(key, value string) {
+	md[key] = value
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a copy of ctx that sends md with calls made with it.
+// Metadata already in ctx is kept unless overridden by a key in md.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	merged := Metadata{}
+	for k, v := range metadataFrom(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+func metadataFrom(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// Metadata returns the metadata sent with the call.
+func (c *Call) Metadata() Metadata {
+	return c.M
+}
+
+// Metadata returns the metadata sent with the response.
+func (r *Response) Metadata() Metadata {
+	return r.M
+}
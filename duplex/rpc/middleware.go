@@ -0,0 +1,152 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+// Middleware wraps a Handler to add behavior before or after it responds.
+type Middleware func(Handler) Handler
+
+// Chain wraps h with the middleware, with the first middleware being the
+// outermost. Use it to apply middleware to the handler for a single pattern.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Use adds middleware applied to every handler matched by the RespondMux,
+// including the "not found" handler. Middleware added to a submux applies
+// inside the middleware of the parent RespondMux.
+func (m *RespondMux) Use(mw ...Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mw = append(m.mw, mw...)
+}
+
+// Interceptor wraps a Caller to add behavior around the calls it makes.
+type Interceptor func(Caller) Caller
+
+// The CallerFunc type is an adapter to allow the use of ordinary functions as Callers.
+type CallerFunc func(ctx context.Context, selector string, params any, reply ...any) (*Response, error)
+
+// Call calls f(ctx, selector, params, reply...).
+func (f CallerFunc) Call(ctx context.Context, selector string, params any, reply ...any) (*Response, error) {
+	return f(ctx, selector, params, reply...)
+}
+
+// Intercept wraps c with the interceptors, with the first interceptor being
+// the outermost.
+func Intercept(c Caller, interceptors ...Interceptor) Caller {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		c = interceptors[i](c)
+	}
+	return c
+}
+
+// wrappedResponder is implemented by Responders that wrap another Responder.
+type wrappedResponder interface {
+	Unwrap() Responder
+}
+
+// baseResponder returns the responder created by the Server, unwrapping
+// any Responders added by middleware.
+func baseResponder(r Responder) (*responder, bool) {
+	for {
+		switch rr := r.(type) {
+		case *responder:
+			return rr, true
+		case wrappedResponder:
+			r = rr.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// statusResponder records whether and with what error a handler responded.
+type statusResponder struct {
+	Responder
+	responded bool
+	err       error
+}
+
+func (r *statusResponder) Unwrap() Responder {
+	return r.Responder
+}
+
+func (r *statusResponder) Return(v ...any) error {
+	r.record(v)
+	return r.Responder.Return(v...)
+}
+
+func (r *statusResponder) Continue(v ...any) (mux.Channel, error) {
+	r.record(v)
+	return r.Responder.Continue(v...)
+}
+
+func (r *statusResponder) record(v []any) {
+	r.responded = true
+	if len(v) == 1 {
+		r.err, _ = v[0].(error)
+	}
+}
+
+// Recover returns middleware that recovers from panics in handlers and returns
+// them to the caller as errors. If the handler has already responded, the panic
+// is logged with slog.Default() instead.
+func Recover() Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(r Responder, c *Call) {
+			sr := &statusResponder{Responder: r}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if sr.responded {
+					slog.Error("rpc: panic after responding", "selector", c.Selector(), "panic", p)
+					return
+				}
+				sr.Return(fmt.Errorf("panic: %v", p))
+			}()
+			h.RespondRPC(sr, c)
+		})
+	}
+}
+
+// Timing returns middleware that calls fn with the selector, duration and
+// returned error of every call once its handler returns.
+func Timing(fn func(selector string, d time.Duration, err error)) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(r Responder, c *Call) {
+			sr := &statusResponder{Responder: r}
+			start := time.Now()
+			defer func() {
+				fn(c.Selector(), time.Since(start), sr.err)
+			}()
+			h.RespondRPC(sr, c)
+		})
+	}
+}
+
+// Logging returns middleware that logs every call to logger once its handler
+// returns. If logger is nil, slog.Default() is used.
+func Logging(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return Timing(func(selector string, d time.Duration, err error) {
+		if err != nil {
+			logger.Error("rpc call", "selector", selector, "duration", d, "error", err)
+			return
+		}
+		logger.Info("rpc call", "selector", selector, "duration", d)
+	})
+}
@@ -0,0 +1,200 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tagMiddleware(tag string, tags *[]string) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(r Responder, c *Call) {
+			*tags = append(*tags, tag)
+			h.RespondRPC(r, c)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("mux and submux order", func(t *testing.T) {
+		var tags []string
+		sub := NewRespondMux()
+		sub.Use(tagMiddleware("sub", &tags))
+		sub.Handle("bar", Chain(HandlerFunc(func(r Responder, c *Call) {
+			r.Return(strings.Join(tags, ","))
+		}), tagMiddleware("pattern", &tags)))
+
+		m := NewRespondMux()
+		m.Use(tagMiddleware("outer1", &tags), tagMiddleware("outer2", &tags))
+		m.Handle("foo", sub)
+
+		client, _ := newTestPair(m)
+		defer client.Close()
+
+		var out string
+		_, err := client.Call(ctx, "foo.bar", nil, &out)
+		fatal(t, err)
+		if out != "outer1,outer2,sub,pattern" {
+			t.Fatalf("unexpected order: %s", out)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var tags []string
+		m := NewRespondMux()
+		m.Use(tagMiddleware("outer", &tags))
+
+		client, _ := newTestPair(m)
+		defer client.Close()
+
+		_, err := client.Call(ctx, "missing", nil)
+		if err == nil {
+			t.Fatal("expected not found error")
+		}
+		if strings.Join(tags, ",") != "outer" {
+			t.Fatalf("unexpected tags: %v", tags)
+		}
+	})
+
+	t.Run("recover", func(t *testing.T) {
+		m := NewRespondMux()
+		m.Use(Recover())
+		m.Handle("panic", HandlerFunc(func(r Responder, c *Call) {
+			panic("oops")
+		}))
+
+		client, _ := newTestPair(m)
+		defer client.Close()
+
+		_, err := client.Call(ctx, "panic", nil)
+		if err == nil || !strings.Contains(err.Error(), "panic: oops") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("recover after responding", func(t *testing.T) {
+		logged := make(logWriter, 1)
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.NewTextHandler(logged, nil)))
+
+		m := NewRespondMux()
+		m.Use(Recover())
+		m.Handle("panic", HandlerFunc(func(r Responder, c *Call) {
+			r.Return("ok")
+			panic("oops")
+		}))
+
+		client, _ := newTestPair(m)
+		defer client.Close()
+
+		_, err := client.Call(ctx, "panic", nil)
+		fatal(t, err)
+		select {
+		case line := <-logged:
+			if !strings.Contains(line, "panic after responding") || !strings.Contains(line, "oops") {
+				t.Fatalf("unexpected log: %s", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected panic to be logged")
+		}
+	})
+
+	t.Run("timing and logging", func(t *testing.T) {
+		errFail := errors.New("fail")
+		type timing struct {
+			selector string
+			err      error
+		}
+		timings := make(chan timing, 2)
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+		m := NewRespondMux()
+		m.Use(Timing(func(selector string, d time.Duration, err error) {
+			timings <- timing{selector, err}
+		}), Logging(logger))
+		m.Handle("ok", HandlerFunc(func(r Responder, c *Call) {
+			r.Return("ok")
+		}))
+		m.Handle("fail", HandlerFunc(func(r Responder, c *Call) {
+			r.Return(errFail)
+		}))
+
+		client, _ := newTestPair(m)
+		defer client.Close()
+
+		_, err := client.Call(ctx, "ok", nil)
+		fatal(t, err)
+		if tm := <-timings; tm.selector != "/ok" || tm.err != nil {
+			t.Fatalf("unexpected timing: %v", tm)
+		}
+		client.Call(ctx, "fail", nil)
+		if tm := <-timings; tm.selector != "/fail" || tm.err != errFail {
+			t.Fatalf("unexpected timing: %v", tm)
+		}
+		if !strings.Contains(buf.String(), "selector=/ok") || !strings.Contains(buf.String(), "level=ERROR") {
+			t.Fatalf("unexpected log output: %s", buf.String())
+		}
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		backmux := NewRespondMux()
+		backmux.Handle("simple", HandlerFunc(func(r Responder, c *Call) {
+			r.Return("simple")
+		}))
+		backend, _ := newTestPair(backmux)
+		defer backend.Close()
+
+		frontmux := NewRespondMux()
+		frontmux.Use(Recover())
+		frontmux.Handle("", ProxyHandler(backend))
+		client, _ := newTestPair(frontmux)
+		defer client.Close()
+
+		var out string
+		_, err := client.Call(ctx, "simple", nil, &out)
+		fatal(t, err)
+		if out != "simple" {
+			t.Fatal("unexpected return:", out)
+		}
+	})
+}
+
+func TestIntercept(t *testing.T) {
+	client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+		r.Return(c.Metadata().Get("tags"))
+	}))
+	defer client.Close()
+
+	tag := func(s string) Interceptor {
+		return func(next Caller) Caller {
+			return CallerFunc(func(ctx context.Context, selector string, params any, reply ...any) (*Response, error) {
+				tags := metadataFrom(ctx).Get("tags")
+				ctx = WithMetadata(ctx, Metadata{"tags": tags + s})
+				return next.Call(ctx, selector, params, reply...)
+			})
+		}
+	}
+
+	caller := Intercept(client, tag("a"), tag("b"))
+	var out string
+	_, err := caller.Call(context.Background(), "", nil, &out)
+	fatal(t, err)
+	if out != "ab" {
+		t.Fatalf("unexpected order: %s", out)
+	}
+}
+
+// logWriter is an io.Writer that sends each write on the channel.
+type logWriter chan string
+
+func (w logWriter) Write(b []byte) (int, error) {
+	w <- string(b)
+	return len(b), nil
+}
@@ -0,0 +1,260 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+// PingSelector is the selector called by a Pool to check the health of its
+// sessions. Any response, including a "not found" error, shows a session is
+// healthy, so servers don't need to handle it.
+const PingSelector = "rpc.ping"
+
+// BalancePolicy is how a Pool picks the session for each call.
+type BalancePolicy int
+
+const (
+	// RoundRobin uses each session in turn.
+	RoundRobin BalancePolicy = iota
+
+	// LeastOutstanding uses the session with the fewest calls waiting for
+	// a response, taking each in turn when there is a tie.
+	LeastOutstanding
+)
+
+// A Dialer makes a session for a Pool, and is used again to replace it once it is evicted.
+type Dialer func() (mux.Session, error)
+
+// PoolConfig configures a Pool. Zero fields use the defaults.
+type PoolConfig struct {
+	// Policy picks the session used for each call. Defaults to RoundRobin.
+	Policy BalancePolicy
+
+	// HealthInterval is how often sessions are pinged with PingSelector, and
+	// PingTimeout how long they have to respond before they are evicted.
+	// Sessions are only pinged if HealthInterval is set. PingTimeout defaults
+	// to 5s.
+	HealthInterval time.Duration
+	PingTimeout    time.Duration
+
+	// RedialDelay is how long to wait before dialing again after a session made
+	// by a Dialer is evicted, or dialing it fails. Defaults to 1s.
+	RedialDelay time.Duration
+}
+
+// Pool is a Caller that balances calls across a set of sessions, such as those
+// to the replicas of a service. Sessions are evicted from the pool when they end
+// or fail a health check, which is also done when a call over them fails with
+// an error that is not a RemoteError. Sessions made by a Dialer are then dialed
+// again until they are replaced.
+type Pool struct {
+	codec  codec.Codec
+	config PoolConfig
+
+	mu      sync.Mutex
+	members []*poolMember
+	next    uint64
+	closed  bool
+	done    chan struct{}
+}
+
+type poolMember struct {
+	client      *Client
+	dial        Dialer
+	outstanding int64
+}
+
+// NewPool returns a Pool making calls with codec. Add sessions
+// with AddSession and AddDialer, and use Close to close them.
+func NewPool(codec codec.Codec, config PoolConfig) *Pool {
+	if config.PingTimeout == 0 {
+		config.PingTimeout = 5 * time.Second
+	}
+	if config.RedialDelay == 0 {
+		config.RedialDelay = time.Second
+	}
+	p := &Pool{
+		codec:  codec,
+		config: config,
+		done:   make(chan struct{}),
+	}
+	if config.HealthInterval > 0 {
+		go p.checkHealth()
+	}
+	return p
+}
+
+// AddSession adds sess to the pool. It is closed once evicted.
+func (p *Pool) AddSession(sess mux.Session) {
+	p.add(sess, nil)
+}
+
+// AddDialer adds a session made by dial to the pool, dialing it in the
+// background. It is dialed again whenever the session is evicted.
+func (p *Pool) AddDialer(dial Dialer) {
+	go p.redial(dial, false)
+}
+
+// Len returns the number of sessions in the pool.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.members)
+}
+
+// Call makes a call with a session picked by the pool policy. It fails with
+// ErrUnavailable if there are no sessions in the pool.
+func (p *Pool) Call(ctx context.Context, selector string, params any, reply ...any) (*Response, error) {
+	m := p.pick()
+	if m == nil {
+		return nil, fmt.Errorf("%w: rpc: no sessions in pool", ErrUnavailable)
+	}
+	atomic.AddInt64(&m.outstanding, 1)
+	resp, err := m.client.Call(ctx, selector, params, reply...)
+	atomic.AddInt64(&m.outstanding, -1)
+	var re RemoteError
+	if err != nil && ctx.Err() == nil && !errors.As(err, &re) {
+		// could be a transport error, or just a bad reply
+		go p.ping(m)
+	}
+	return resp, err
+}
+
+// Close closes the sessions in the pool and stops dialing. Calls
+// made after Close fail with ErrUnavailable.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	members := p.members
+	p.members = nil
+	p.mu.Unlock()
+
+	var errs []error
+	for _, m := range members {
+		errs = append(errs, m.client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pool) pick() *poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.members) == 0 {
+		return nil
+	}
+	start := int(p.next % uint64(len(p.members)))
+	p.next++
+	if p.config.Policy != LeastOutstanding {
+		return p.members[start]
+	}
+	var least *poolMember
+	for i := range p.members {
+		m := p.members[(start+i)%len(p.members)]
+		if least == nil || atomic.LoadInt64(&m.outstanding) < atomic.LoadInt64(&least.outstanding) {
+			least = m
+		}
+	}
+	return least
+}
+
+func (p *Pool) add(sess mux.Session, dial Dialer) {
+	m := &poolMember{client: NewClient(sess, p.codec), dial: dial}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		sess.Close()
+		return
+	}
+	p.members = append(p.members, m)
+	p.mu.Unlock()
+
+	go func() {
+		sess.Wait()
+		p.evict(m)
+	}()
+}
+
+// evict removes m from the pool and closes its session, redialing
+// it if it was made by a Dialer.
+func (p *Pool) evict(m *poolMember) {
+	p.mu.Lock()
+	found := false
+	for i, mm := range p.members {
+		if mm == m {
+			p.members = append(p.members[:i:i], p.members[i+1:]...)
+			found = true
+			break
+		}
+	}
+	p.mu.Unlock()
+	if !found {
+		return
+	}
+	m.client.Close()
+	if m.dial != nil {
+		go p.redial(m.dial, true)
+	}
+}
+
+// redial dials until it adds a session to the pool or the pool is closed,
+// waiting RedialDelay first if wait is set and between attempts.
+func (p *Pool) redial(dial Dialer, wait bool) {
+	for {
+		if wait {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(p.config.RedialDelay):
+			}
+		}
+		wait = true
+		sess, err := dial()
+		if err == nil {
+			p.add(sess, dial)
+			return
+		}
+	}
+}
+
+// checkHealth pings the sessions every HealthInterval until the pool is
+// closed, evicting those that don't respond within PingTimeout.
+func (p *Pool) checkHealth() {
+	t := time.NewTicker(p.config.HealthInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		members := append([]*poolMember(nil), p.members...)
+		p.mu.Unlock()
+		for _, m := range members {
+			go p.ping(m)
+		}
+	}
+}
+
+// ping calls PingSelector with m, evicting it if there is no response within PingTimeout.
+func (p *Pool) ping(m *poolMember) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.PingTimeout)
+	defer cancel()
+	_, err := m.client.Call(ctx, PingSelector, nil)
+	var re RemoteError
+	if err != nil && !errors.As(err, &re) {
+		p.evict(m)
+	}
+}
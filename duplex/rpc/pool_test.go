@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+// replica returns a client session to a server over TCP that returns name,
+// and the server session to close to end it.
+func replica(t *testing.T, name string, block chan struct{}) (client, server mux.Session) {
+	t.Helper()
+	client, server = tcpSessions(t)
+	srv := &Server{Codec: codec.JSONCodec{}, Handler: HandlerFunc(func(r Responder, c *Call) {
+		c.Receive(nil)
+		if block != nil && c.Selector() == "/block" {
+			<-block
+		}
+		r.Return(name)
+	})}
+	go srv.Respond(server, nil)
+	return client, server
+}
+
+// tcpSessions returns sessions connected over TCP, which unlike pipes
+// buffer writes, so sessions can handle many concurrent calls.
+func tcpSessions(t *testing.T) (client, server mux.Session) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	fatal(t, err)
+	defer l.Close()
+	accepted := make(chan mux.Session, 1)
+	go func() {
+		sess, _ := mux.ListenerFrom(l).Accept()
+		accepted <- sess
+	}()
+	client, err = mux.DialTCP(l.Addr().String())
+	fatal(t, err)
+	server = <-accepted
+	if server == nil {
+		t.Fatal("failed to accept session")
+	}
+	return client, server
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func callNames(t *testing.T, pool *Pool, n int) string {
+	t.Helper()
+	var names []string
+	for i := 0; i < n; i++ {
+		var name string
+		_, err := pool.Call(context.Background(), "name", nil, &name)
+		fatal(t, err)
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("round robin", func(t *testing.T) {
+		pool := NewPool(codec.JSONCodec{}, PoolConfig{})
+		defer pool.Close()
+		for _, name := range []string{"a", "b", "c"} {
+			sess, _ := replica(t, name, nil)
+			pool.AddSession(sess)
+		}
+		if names := callNames(t, pool, 6); names != "a,b,c,a,b,c" {
+			t.Fatalf("unexpected order: %s", names)
+		}
+	})
+
+	t.Run("least outstanding", func(t *testing.T) {
+		pool := NewPool(codec.JSONCodec{}, PoolConfig{Policy: LeastOutstanding})
+		defer pool.Close()
+		block := make(chan struct{})
+		for _, name := range []string{"a", "b"} {
+			sess, _ := replica(t, name, block)
+			pool.AddSession(sess)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var name string
+			pool.Call(ctx, "block", nil, &name)
+			if name != "a" {
+				t.Errorf("unexpected replica: %s", name)
+			}
+		}()
+		waitFor(t, "call to block", func() bool {
+			pool.mu.Lock()
+			defer pool.mu.Unlock()
+			return atomic.LoadInt64(&pool.members[0].outstanding) == 1
+		})
+		if names := callNames(t, pool, 3); names != "b,b,b" {
+			t.Fatalf("unexpected replicas: %s", names)
+		}
+		close(block)
+		wg.Wait()
+		if names := callNames(t, pool, 2); names != "a,b" && names != "b,a" {
+			t.Fatalf("unexpected replicas: %s", names)
+		}
+	})
+
+	t.Run("evict ended", func(t *testing.T) {
+		pool := NewPool(codec.JSONCodec{}, PoolConfig{})
+		defer pool.Close()
+		sessA, srvA := replica(t, "a", nil)
+		sessB, _ := replica(t, "b", nil)
+		pool.AddSession(sessA)
+		pool.AddSession(sessB)
+
+		srvA.Close()
+		waitFor(t, "eviction", func() bool { return pool.Len() == 1 })
+		if names := callNames(t, pool, 3); names != "b,b,b" {
+			t.Fatalf("unexpected replicas: %s", names)
+		}
+	})
+
+	t.Run("redial", func(t *testing.T) {
+		pool := NewPool(codec.JSONCodec{}, PoolConfig{RedialDelay: 10 * time.Millisecond})
+		defer pool.Close()
+		clientA, serverA := replica(t, "a", nil)
+		clientB, _ := replica(t, "b", nil)
+		var mu sync.Mutex
+		var dials int
+		pool.AddDialer(func() (mux.Session, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			dials++
+			switch dials {
+			case 1:
+				return clientA, nil
+			case 2:
+				return nil, errors.New("refused")
+			default:
+				return clientB, nil
+			}
+		})
+		waitFor(t, "dial", func() bool { return pool.Len() == 1 })
+
+		serverA.Close()
+		waitFor(t, "redial", func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return dials == 3 && pool.Len() == 1
+		})
+		if names := callNames(t, pool, 1); names != "b" {
+			t.Fatalf("unexpected replicas: %s", names)
+		}
+	})
+
+	t.Run("health check", func(t *testing.T) {
+		pool := NewPool(codec.JSONCodec{}, PoolConfig{
+			HealthInterval: 10 * time.Millisecond,
+			PingTimeout:    20 * time.Millisecond,
+		})
+		defer pool.Close()
+		healthy, _ := replica(t, "a", nil)
+		pool.AddSession(healthy)
+		// a session nobody is responding to
+		unresponsive, _ := tcpSessions(t)
+		pool.AddSession(unresponsive)
+
+		waitFor(t, "eviction", func() bool { return pool.Len() == 1 })
+		time.Sleep(50 * time.Millisecond)
+		if names := callNames(t, pool, 2); names != "a,a" {
+			t.Fatalf("unexpected replicas: %s", names)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		pool := NewPool(codec.JSONCodec{}, PoolConfig{})
+		_, err := pool.Call(ctx, "name", nil)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sess, _ := replica(t, "a", nil)
+		pool.AddSession(sess)
+		fatal(t, pool.Close())
+		_, err = pool.Call(ctx, "name", nil)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -1,12 +1,21 @@
 package rpc
 
-import "io"
+import (
+	"errors"
+	"io"
+)
 
 // ProxyHandler returns a handler that tries its best to proxy the
 // call to the dst Client, regardless of call style and assuming the
 // same encoding.
 func ProxyHandler(dst *Client) Handler {
 	return HandlerFunc(func(r Responder, c *Call) {
+		resp, ok := baseResponder(r)
+		if !ok {
+			r.Return(errors.New("rpc: unable to proxy with responder"))
+			return
+		}
+
 		ch, err := dst.Session.Open(c.Context)
 		if err != nil {
 			r.Return(err)
@@ -17,6 +26,8 @@ func ProxyHandler(dst *Client) Handler {
 		enc := framer.Encoder(ch)
 		err = enc.Encode(CallHeader{
 			S: c.Selector(),
+			T: timeoutFrom(c.Context),
+			M: c.M,
 		})
 		if err != nil {
 			ch.Close()
@@ -33,7 +44,7 @@ func ProxyHandler(dst *Client) Handler {
 			c.Channel.Close()
 		}()
 
-		r.(*responder).responded = true
-		r.(*responder).header.C = true
+		resp.responded = true
+		resp.header.C = true
 	})
 }
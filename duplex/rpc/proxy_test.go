@@ -64,3 +64,31 @@ func TestProxyHandlerBytestream(t *testing.T) {
 		t.Fatal("unexpected return data:", string(b))
 	}
 }
+
+func TestProxyHandlerMetadata(t *testing.T) {
+	backmux := NewRespondMux()
+	backmux.Handle("meta", HandlerFunc(func(r Responder, c *Call) {
+		r.Header().Set("reply", "pong")
+		r.Return(c.Metadata().Get("token"))
+	}))
+
+	backend, _ := newTestPair(backmux)
+	defer backend.Close()
+
+	frontmux := NewRespondMux()
+	frontmux.Handle("", ProxyHandler(backend))
+
+	client, _ := newTestPair(frontmux)
+	defer client.Close()
+
+	ctx := WithMetadata(context.Background(), Metadata{"token": "secret"})
+	var out string
+	resp, err := client.Call(ctx, "meta", nil, &out)
+	fatal(t, err)
+	if out != "secret" {
+		t.Fatal("unexpected return:", out)
+	}
+	if resp.Metadata().Get("reply") != "pong" {
+		t.Fatal("unexpected response metadata:", resp.Metadata())
+	}
+}
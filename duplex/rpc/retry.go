@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures the calls retried by Retry and how long it waits
+// between attempts. Zero fields use the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a call is made, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is the most to wait before the first retry, and
+	// MaxBackoff the most to wait before any retry. The limit grows by
+	// Multiplier after each retry and the wait is chosen at random below
+	// it. They default to 100ms, 5s and 2.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Codes are the RemoteError codes that are retried. Defaults to
+	// CodeUnavailable and CodeResourceExhausted.
+	Codes []string
+}
+
+var idempotentRegistry struct {
+	sync.RWMutex
+	selectors map[string]bool
+}
+
+// RegisterIdempotent marks selectors as idempotent, so calls to them are
+// retried by Retry. A selector ending in "." marks all selectors under it.
+func RegisterIdempotent(selectors ...string) {
+	idempotentRegistry.Lock()
+	defer idempotentRegistry.Unlock()
+	if idempotentRegistry.selectors == nil {
+		idempotentRegistry.selectors = make(map[string]bool)
+	}
+	for _, s := range selectors {
+		idempotentRegistry.selectors[cleanSelector(s)] = true
+	}
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent returns a context that marks calls made with it as
+// idempotent, so they are retried by Retry whatever their selector.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// isIdempotent reports whether the call to selector with ctx can be retried.
+func isIdempotent(ctx context.Context, selector string) bool {
+	if ok, _ := ctx.Value(idempotentKey{}).(bool); ok {
+		return true
+	}
+	selector = cleanSelector(selector)
+	idempotentRegistry.RLock()
+	defer idempotentRegistry.RUnlock()
+	if idempotentRegistry.selectors[selector] {
+		return true
+	}
+	for s := range idempotentRegistry.selectors {
+		if strings.HasSuffix(s, "/") && strings.HasPrefix(selector, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry returns an interceptor that retries calls to idempotent selectors that
+// fail with transport errors or RemoteErrors with retryable codes, waiting with
+// exponential backoff and jitter between attempts. Calls are idempotent if their
+// selector was registered with RegisterIdempotent or their context was made with
+// WithIdempotent.
+//
+// Calls streaming args from a channel and calls with continued responses are
+// never retried. Retrying stops when the context is done, or when its deadline
+// would pass before the next attempt, returning the last error.
+func Retry(policy RetryPolicy) Interceptor {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.InitialBackoff == 0 {
+		policy.InitialBackoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = 5 * time.Second
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = 2
+	}
+	if policy.Codes == nil {
+		policy.Codes = []string{CodeUnavailable, CodeResourceExhausted}
+	}
+	return func(next Caller) Caller {
+		return CallerFunc(func(ctx context.Context, selector string, params any, reply ...any) (*Response, error) {
+			if _, isChan := params.(chan interface{}); isChan || !isIdempotent(ctx, selector) {
+				return next.Call(ctx, selector, params, reply...)
+			}
+			limit := policy.InitialBackoff
+			for attempt := 1; ; attempt++ {
+				resp, err := next.Call(ctx, selector, params, reply...)
+				if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(ctx, resp, err) {
+					return resp, err
+				}
+				wait := time.Duration(rand.Int63n(int64(limit) + 1))
+				if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+					return resp, err
+				}
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return resp, err
+				case <-t.C:
+				}
+				limit = min(time.Duration(float64(limit)*policy.Multiplier), policy.MaxBackoff)
+			}
+		})
+	}
+}
+
+// retryable reports whether a call that returned resp and err can be retried.
+func (p RetryPolicy) retryable(ctx context.Context, resp *Response, err error) bool {
+	if ctx.Err() != nil || resp != nil && resp.Continue() {
+		return false
+	}
+	var re RemoteError
+	if !errors.As(err, &re) {
+		// transport errors
+		return true
+	}
+	for _, code := range p.Codes {
+		if re.Code == code {
+			return true
+		}
+	}
+	return false
+}
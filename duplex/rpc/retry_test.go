@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	RegisterIdempotent("retry.get", "retry.list.")
+
+	// failing returns a caller that fails with err until it has been called n times.
+	failing := func(n int, err error, calls *int) Caller {
+		return CallerFunc(func(ctx context.Context, selector string, params any, reply ...any) (*Response, error) {
+			*calls++
+			if *calls <= n {
+				return nil, err
+			}
+			return &Response{}, nil
+		})
+	}
+	unavailable := RemoteError{Code: CodeUnavailable, Message: "unavailable"}
+	policy := RetryPolicy{InitialBackoff: time.Millisecond}
+
+	t.Run("idempotent", func(t *testing.T) {
+		for _, tc := range []struct {
+			selector string
+			ctx      context.Context
+			calls    int
+		}{
+			{"retry.get", ctx, 3},
+			{"retry/list/all", ctx, 3},
+			{"retry.put", ctx, 1},
+			{"retry.put", WithIdempotent(ctx), 3},
+		} {
+			var calls int
+			caller := Intercept(failing(2, unavailable, &calls), Retry(policy))
+			_, err := caller.Call(tc.ctx, tc.selector, nil)
+			if calls != tc.calls {
+				t.Fatalf("%s: expected %d calls, got %d", tc.selector, tc.calls, calls)
+			}
+			if tc.calls == 3 {
+				fatal(t, err)
+			} else if !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("%s: unexpected error: %v", tc.selector, err)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			err   error
+			calls int
+		}{
+			{errors.New("connection reset"), 3},
+			{RemoteError{Code: CodeResourceExhausted, Message: "busy"}, 3},
+			{RemoteError{Code: CodeNotFound, Message: "not found"}, 1},
+			{RemoteError{Message: "failed"}, 1},
+		} {
+			var calls int
+			caller := Intercept(failing(2, tc.err, &calls), Retry(policy))
+			caller.Call(ctx, "retry.get", nil)
+			if calls != tc.calls {
+				t.Fatalf("%v: expected %d calls, got %d", tc.err, tc.calls, calls)
+			}
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		var calls int
+		caller := Intercept(failing(10, unavailable, &calls), Retry(RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: time.Millisecond,
+			Codes:          []string{CodeUnavailable},
+		}))
+		_, err := caller.Call(ctx, "retry.get", nil)
+		if calls != 5 || !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("unexpected result: %d calls, %v", calls, err)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		var calls int
+		caller := Intercept(failing(10, unavailable, &calls), Retry(RetryPolicy{
+			MaxAttempts:    100,
+			InitialBackoff: 20 * time.Millisecond,
+		}))
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := caller.Call(ctx, "retry.get", nil)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if time.Since(start) > 100*time.Millisecond {
+			t.Fatal("expected retries to stop before the deadline")
+		}
+		if calls < 2 {
+			t.Fatalf("expected call to be retried, got %d calls", calls)
+		}
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		var calls int
+		caller := Intercept(CallerFunc(func(ctx context.Context, selector string, params any, reply ...any) (*Response, error) {
+			calls++
+			return &Response{ResponseHeader: ResponseHeader{C: true}}, errors.New("bad reply")
+		}), Retry(policy))
+		caller.Call(ctx, "retry.get", nil)
+		if calls != 1 {
+			t.Fatalf("expected continued response not to be retried, got %d calls", calls)
+		}
+
+		calls = 0
+		caller = Intercept(failing(2, unavailable, &calls), Retry(policy))
+		args := make(chan interface{})
+		close(args)
+		caller.Call(ctx, "retry.get", args)
+		if calls != 1 {
+			t.Fatalf("expected streamed args not to be retried, got %d calls", calls)
+		}
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		var calls int
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			c.Receive(nil)
+			calls++
+			if calls < 3 {
+				r.Return(fmt.Errorf("%w: try again", ErrUnavailable))
+				return
+			}
+			r.Return("ok")
+		}))
+		defer client.Close()
+
+		var out string
+		_, err := Intercept(client, Retry(policy)).Call(ctx, "retry.get", nil, &out)
+		fatal(t, err)
+		if out != "ok" || calls != 3 {
+			t.Fatalf("unexpected result: %v after %d calls", out, calls)
+		}
+	})
+}
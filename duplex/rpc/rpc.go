@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 
-	"github.com/mitchellh/mapstructure"
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
 )
@@ -28,7 +27,10 @@ type Caller interface {
 
 // CallHeader is the first value encoded over the channel to make a call.
 type CallHeader struct {
-	S string // Selector
+	S string   // Selector
+	F []uint64 `json:",omitempty"` // Files: IDs of files sent with the call
+	T int64    `json:",omitempty"` // Timeout: milliseconds left before the caller's deadline
+	M Metadata `json:",omitempty"` // Metadata
 }
 
 // Call is used on the responding side of a call and is passed to the handler.
@@ -41,6 +43,8 @@ type Call struct {
 	Context context.Context
 
 	mux.Channel
+
+	sess mux.Session
 }
 
 func (c *Call) Selector() string {
@@ -60,8 +64,11 @@ func (c *Call) Receive(v interface{}) error {
 
 // ResponseHeader is the value encoded over the channel to indicate a response.
 type ResponseHeader struct {
-	E *string // Error
-	C bool    // Continue: after parsing response, keep stream open for whatever protocol
+	E *string      // Error
+	C bool         // Continue: after parsing response, keep stream open for whatever protocol
+	F []uint64     `json:",omitempty"` // Files: IDs of files sent with the response
+	M Metadata     `json:",omitempty"` // Metadata
+	X *RemoteError `json:",omitempty"` // Error code and details, if any, for the message in E
 }
 
 // Response is used on the calling side to represent a response and allow access
@@ -74,6 +81,7 @@ type Response struct {
 	Channel mux.Channel
 
 	codec codec.Codec
+	sess  mux.Session
 }
 
 func (r *Response) Err() error {
@@ -83,6 +91,20 @@ func (r *Response) Err() error {
 	return errors.New(*r.E)
 }
 
+// remoteError returns the RemoteError for the response, or nil if
+// there was no error.
+func (r *Response) remoteError() error {
+	if r.E == nil {
+		return nil
+	}
+	if r.X != nil {
+		re := *r.X
+		re.Message = *r.E
+		return re
+	}
+	return RemoteError{Message: *r.E}
+}
+
 func (r *Response) Continue() bool {
 	return r.C
 }
@@ -118,6 +140,10 @@ type Responder interface {
 	// Send encodes a value over the underlying channel, but does not initiate a response,
 	// so it must be used after calling Continue.
 	Send(interface{}) error
+
+	// Header returns the metadata that will be sent with the response. Changing it after
+	// calling Return or Continue has no effect.
+	Header() Metadata
 }
 
 type responder struct {
@@ -125,12 +151,30 @@ type responder struct {
 	header    *ResponseHeader
 	ch        mux.Channel
 	c         codec.Codec
+	sess      mux.Session
+	lim       *limiter // session limiter the call was let through, until released
+	selector  string
+}
+
+// releaseLimit releases the call from the session limiter, if it is limited.
+func (r *responder) releaseLimit() {
+	if r.lim != nil {
+		r.lim.release(r.selector)
+		r.lim = nil
+	}
 }
 
 func (r *responder) Send(v interface{}) error {
 	return r.c.Encoder(r.ch).Encode(v)
 }
 
+func (r *responder) Header() Metadata {
+	if r.header.M == nil {
+		r.header.M = Metadata{}
+	}
+	return r.header.M
+}
+
 func (r *responder) Return(v ...any) error {
 	return r.respond(v, false)
 }
@@ -152,8 +196,7 @@ func (r *responder) respond(values []any, continue_ bool) error {
 			values = []any{nil}
 		}
 		if e != nil {
-			var errStr = e.Error()
-			r.header.E = &errStr
+			r.setError(e)
 		}
 	}
 
@@ -179,19 +222,31 @@ func (r *responder) respond(values []any, continue_ bool) error {
 	return nil
 }
 
+// setError puts err in the header, with its code and details if it has any.
+func (r *responder) setError(err error) {
+	r.header.setError(err)
+}
+
+func (h *ResponseHeader) setError(err error) {
+	re := RemoteErrorFrom(err)
+	msg := re.Message
+	h.E = &msg
+	if re.Code != "" || re.Details != nil {
+		re.Message = ""
+		h.X = &re
+	}
+}
+
 // ReceiveNotify takes a continued response and sends received values to a channel,
 // until an error is returned or the context finishes. In either case, the response
-// and the channel will be closed.
+// and the channel will be closed. Values are decoded into T by the codec, so struct
+// fields use json tags.
 func ReceiveNotify[T any](ctx context.Context, resp *Response, ch chan T) error {
 	defer close(ch)
 	defer resp.Close()
 	for {
-		var v any
-		if err := resp.Receive(&v); err != nil {
-			return err
-		}
 		var vv T
-		if err := mapstructure.Decode(v, &vv); err != nil {
+		if err := resp.Receive(&vv); err != nil {
 			return err
 		}
 		select {
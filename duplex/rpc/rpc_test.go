@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -219,6 +220,28 @@ func TestRespondMux(t *testing.T) {
 		}
 	})
 
+	t.Run("remove sub mux", func(t *testing.T) {
+		sub := NewRespondMux()
+		sub.Handle("bar", HandlerFunc(func(r Responder, c *Call) {
+			r.Return("bar")
+		}))
+		mux := NewRespondMux()
+		mux.Handle("foo", sub)
+
+		client, _ := newTestPair(mux)
+		defer client.Close()
+
+		_, err := client.Call(ctx, "foo.bar", nil, nil)
+		fatal(t, err)
+
+		mux.Remove("foo/")
+
+		_, err = client.Call(ctx, "foo.bar", nil, nil)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
 	t.Run("bad handler: nil", func(t *testing.T) {
 		defer func() {
 			if r := recover(); r == nil {
@@ -461,7 +484,11 @@ func TestRPC(t *testing.T) {
 
 	t.Run("call timeout", func(t *testing.T) {
 		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
-			time.Sleep(200 * time.Millisecond)
+			select {
+			case <-time.After(200 * time.Millisecond):
+			case <-c.Context.Done():
+				return
+			}
 			fatal(t, c.Receive(nil))
 			_, err := r.Continue(nil)
 			fatal(t, err)
@@ -490,3 +517,158 @@ func TestRPC(t *testing.T) {
 	})
 
 }
+
+func TestCallContext(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("deadline", func(t *testing.T) {
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			deadline, ok := c.Context.Deadline()
+			if !ok {
+				r.Return(fmt.Errorf("no deadline"))
+				return
+			}
+			r.Return(time.Until(deadline) > 0 && time.Until(deadline) <= time.Second)
+		}))
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		var ok bool
+		_, err := client.Call(ctx, "", nil, &ok)
+		fatal(t, err)
+		if !ok {
+			t.Fatal("unexpected deadline")
+		}
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		errs := make(chan error, 1)
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			<-c.Context.Done()
+			errs <- c.Context.Err()
+		}))
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+
+		client.Call(ctx, "", nil)
+		select {
+		case err := <-errs:
+			if err != context.DeadlineExceeded {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler context not cancelled")
+		}
+	})
+
+	t.Run("remote error at deadline", func(t *testing.T) {
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			r.Return(fmt.Errorf("%w: no user", ErrNotFound))
+		}))
+		defer client.Close()
+
+		_, err := client.Call(expiredContext{ctx}, "", nil)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected remote error, got: %v", err)
+		}
+	})
+
+	t.Run("caller cancel", func(t *testing.T) {
+		errs := make(chan error, 1)
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			<-c.Context.Done()
+			errs <- c.Context.Err()
+		}))
+		defer client.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+		}()
+
+		client.Call(ctx, "", nil)
+		select {
+		case err := <-errs:
+			if err != context.Canceled {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler context not cancelled")
+		}
+	})
+
+	t.Run("session end", func(t *testing.T) {
+		started := make(chan struct{})
+		errs := make(chan error, 1)
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			close(started)
+			<-c.Context.Done()
+			errs <- c.Context.Err()
+		}))
+
+		go client.Call(ctx, "", nil)
+		<-started
+		client.Close()
+		select {
+		case err := <-errs:
+			if err != context.Canceled {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler context not cancelled")
+		}
+	})
+
+	t.Run("returned", func(t *testing.T) {
+		ctxs := make(chan context.Context, 1)
+		client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+			ctxs <- c.Context
+			r.Return(nil)
+		}))
+		defer client.Close()
+
+		_, err := client.Call(ctx, "", nil)
+		fatal(t, err)
+		select {
+		case <-(<-ctxs).Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler context not cancelled")
+		}
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	client, _ := newTestPair(HandlerFunc(func(r Responder, c *Call) {
+		r.Header().Set("trace", c.Metadata().Get("trace"))
+		r.Return(c.Metadata().Get("token"))
+	}))
+	defer client.Close()
+
+	ctx := WithMetadata(context.Background(), Metadata{"token": "secret"})
+	ctx = WithMetadata(ctx, Metadata{"trace": "abc123"})
+
+	var out string
+	resp, err := client.Call(ctx, "", nil, &out)
+	fatal(t, err)
+	if out != "secret" {
+		t.Fatalf("unexpected return: %#v", out)
+	}
+	if resp.Metadata().Get("trace") != "abc123" {
+		t.Fatalf("unexpected response metadata: %#v", resp.Metadata())
+	}
+}
+
+// expiredContext is a context whose deadline has passed,
+// but which has not been cancelled yet.
+type expiredContext struct {
+	context.Context
+}
+
+func (expiredContext) Deadline() (time.Time, bool) {
+	return time.Now().Add(-time.Millisecond), true
+}
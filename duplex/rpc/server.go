@@ -2,25 +2,60 @@ package rpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
+	"sync"
+	"time"
 
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
 )
 
+// ErrServerClosed is returned by the Server's Serve, ServeMux and Respond methods after a call to Shutdown.
+var ErrServerClosed = errors.New("rpc: server closed")
+
 // Server wraps a Handler and codec to respond to RPC calls.
 type Server struct {
 	Handler Handler
 	Codec   codec.Codec
+
+	// Limits are applied to the calls of each session passed to Respond.
+	// Calls over the limits are queued or rejected with ErrResourceExhausted.
+	Limits Limits
+
+	// Authenticator, if set, must authenticate each session passed to Respond
+	// before calls are handled. See Authenticate for the calling side.
+	Authenticator Authenticator
+
+	// AuthTimeout is how long a session has to authenticate before it is
+	// closed, when there is an Authenticator. Defaults to DefaultAuthTimeout.
+	AuthTimeout time.Duration
+
+	mu        sync.Mutex
+	closing   bool
+	inFlight  int
+	idle      chan struct{}
+	listeners map[mux.Listener]struct{}
+	sessions  map[mux.Session]struct{}
 }
 
 // ServeMux will Accept sessions until the Listener is closed, and will Respond to accepted sessions in their own goroutine.
+// After Shutdown, ServeMux returns ErrServerClosed.
 func (s *Server) ServeMux(l mux.Listener) error {
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+
 	for {
 		sess, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
 		go s.Respond(sess, nil)
@@ -28,6 +63,7 @@ func (s *Server) ServeMux(l mux.Listener) error {
 }
 
 // Serve will Accept sessions until the Listener is closed, and will Respond to accepted sessions in their own goroutine.
+// After Shutdown, Serve returns ErrServerClosed.
 func (s *Server) Serve(l net.Listener) error {
 	return s.ServeMux(mux.ListenerFrom(l))
 }
@@ -36,32 +72,180 @@ func (s *Server) Serve(l net.Listener) error {
 // If Handler was not set, an empty RespondMux is used. If the handler does not initiate a response, a nil value is
 // returned. If the handler does not call Continue, the channel will be closed. Respond will panic if Codec is nil.
 //
-// If the context is not nil, it will be added to Calls. Otherwise the Call Context will be set to a context.Background().
-func (s *Server) Respond(sess mux.Session, ctx context.Context) {
+// If the context is not nil, Call contexts will be derived from it. Otherwise they are derived from context.Background().
+// A Call context is cancelled when the deadline sent by the caller passes, when the caller closes the channel, when the
+// Session ends, or when the handler returns without calling Continue.
+//
+// Respond returns nil when the Session is closed, ErrServerClosed after Shutdown, or any other error from accepting channels.
+func (s *Server) Respond(sess mux.Session, ctx context.Context) error {
 	defer sess.Close()
 
 	if s.Codec == nil {
 		panic("rpc.Respond: nil codec")
 	}
 
+	if !s.trackSession(sess, true) {
+		return ErrServerClosed
+	}
+	defer s.trackSession(sess, false)
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.Authenticator != nil {
+		var err error
+		ctx, err = s.authenticate(sess, ctx)
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+
 	hn := s.Handler
 	if hn == nil {
 		hn = NewRespondMux()
 	}
+	lim := newLimiter(s.Limits)
 
 	for {
 		ch, err := sess.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			if err == io.EOF {
-				return
+				return nil
 			}
-			panic(err)
+			return err
 		}
-		go s.respond(hn, sess, ch, ctx)
+		if !s.startCall() {
+			go s.respond(unavailableHandler, nil, sess, ch, ctx)
+			continue
+		}
+		go func() {
+			defer s.finishCall()
+			s.respond(hn, lim, sess, ch, ctx)
+		}()
+	}
+}
+
+// Shutdown gracefully shuts down the server. It closes all listeners passed to Serve or ServeMux, responds to
+// new calls with ErrUnavailable, and waits for in-flight handlers to return. Then it closes all sessions passed to
+// Respond. If ctx expires first, sessions are closed anyway and Shutdown returns the number of handlers that were
+// still in flight along with the context error.
+func (s *Server) Shutdown(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	s.closing = true
+	if s.idle == nil {
+		s.idle = make(chan struct{})
+		if s.inFlight == 0 {
+			close(s.idle)
+		}
+	}
+	idle := s.idle
+	for l := range s.listeners {
+		l.Close()
+	}
+	s.mu.Unlock()
+
+	var err error
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess := range s.sessions {
+		sess.Close()
 	}
+	return s.inFlight, err
 }
 
-func (s *Server) respond(hn Handler, sess mux.Session, ch mux.Channel, ctx context.Context) {
+// InFlight returns the number of handlers currently responding to calls.
+func (s *Server) InFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Server) startCall() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.inFlight++
+	return true
+}
+
+func (s *Server) finishCall() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.inFlight == 0 && s.idle != nil {
+		close(s.idle)
+	}
+}
+
+// trackListener adds or removes a listener closed by Shutdown. It returns
+// false if the listener could not be added because of Shutdown.
+func (s *Server) trackListener(l mux.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.closing {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[mux.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// trackSession adds or removes a session closed by Shutdown. It returns
+// false if the session could not be added because of Shutdown.
+func (s *Server) trackSession(sess mux.Session, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.sessions, sess)
+		return true
+	}
+	if s.closing {
+		return false
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[mux.Session]struct{})
+	}
+	s.sessions[sess] = struct{}{}
+	return true
+}
+
+var unavailableHandler = HandlerFunc(func(r Responder, c *Call) {
+	r.Return(fmt.Errorf("%w: server shutting down", ErrUnavailable))
+})
+
+func (s *Server) respond(hn Handler, lim *limiter, sess mux.Session, ch mux.Channel, ctx context.Context) {
 	framer := &FrameCodec{Codec: s.Codec}
 	dec := framer.Decoder(ch)
 
@@ -78,18 +262,31 @@ func (s *Server) respond(hn Handler, sess mux.Session, ch mux.Channel, ctx conte
 		Session: sess,
 		codec:   s.Codec,
 	}
-	if ctx == nil {
-		call.Context = context.Background()
-	} else {
-		call.Context = ctx
-	}
+	var cancel context.CancelFunc
+	call.Context, cancel = callContext(ctx, call.CallHeader, ch)
 	call.Channel = ch
+	call.sess = sess
 
 	header := &ResponseHeader{}
 	resp := &responder{
 		ch:     ch,
 		c:      framer,
 		header: header,
+		sess:   sess,
+	}
+
+	if lim != nil {
+		if err := lim.acquire(call.Context, call.S); err != nil {
+			if call.Context.Err() == nil {
+				resp.Return(err)
+			}
+			// otherwise the caller is gone or gave up while waiting
+			ch.Close()
+			cancel()
+			return
+		}
+		resp.lim, resp.selector = lim, call.S
+		defer resp.releaseLimit()
 	}
 
 	hn.RespondRPC(resp, &call)
@@ -98,5 +295,28 @@ func (s *Server) respond(hn Handler, sess mux.Session, ch mux.Channel, ctx conte
 	}
 	if !resp.header.C {
 		ch.Close()
+		cancel()
+	}
+}
+
+// callContext derives the context for a call from the session context,
+// applying the timeout from the header and cancelling it when the
+// channel is torn down.
+func callContext(ctx context.Context, header CallHeader, ch mux.Channel) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if header.T > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(header.T)*time.Millisecond)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	if dc, ok := ch.(interface{ Done() <-chan struct{} }); ok {
+		go func() {
+			select {
+			case <-dc.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
 	}
+	return ctx, cancel
 }
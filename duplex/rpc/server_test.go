@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+)
+
+func TestServerShutdown(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("waits for in-flight calls", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		sessA, sessB := pipeSessions()
+		srv := &Server{
+			Codec: codec.JSONCodec{},
+			Handler: HandlerFunc(func(r Responder, c *Call) {
+				close(started)
+				<-release
+				r.Return("done")
+			}),
+		}
+		responded := make(chan error, 1)
+		go func() {
+			responded <- srv.Respond(sessA, nil)
+		}()
+		client := NewClient(sessB, codec.JSONCodec{})
+		defer client.Close()
+
+		var out string
+		called := make(chan error, 1)
+		go func() {
+			_, err := client.Call(ctx, "", nil, &out)
+			called <- err
+		}()
+		<-started
+		if n := srv.InFlight(); n != 1 {
+			t.Fatalf("unexpected in-flight count: %d", n)
+		}
+
+		type result struct {
+			n   int
+			err error
+		}
+		shutdown := make(chan result, 1)
+		go func() {
+			n, err := srv.Shutdown(ctx)
+			shutdown <- result{n, err}
+		}()
+
+		for !srv.shuttingDown() {
+			time.Sleep(time.Millisecond)
+		}
+		_, err := client.Call(ctx, "", nil)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("expected unavailable error: %v", err)
+		}
+
+		close(release)
+		fatal(t, <-called)
+		if out != "done" {
+			t.Fatalf("unexpected return: %v", out)
+		}
+		if res := <-shutdown; res.n != 0 || res.err != nil {
+			t.Fatalf("unexpected shutdown result: %v", res)
+		}
+		if err := <-responded; err != ErrServerClosed {
+			t.Fatalf("unexpected respond error: %v", err)
+		}
+	})
+
+	t.Run("context expires", func(t *testing.T) {
+		started := make(chan struct{})
+		sessA, sessB := pipeSessions()
+		srv := &Server{
+			Codec: codec.JSONCodec{},
+			Handler: HandlerFunc(func(r Responder, c *Call) {
+				close(started)
+				<-c.Context.Done()
+			}),
+		}
+		go srv.Respond(sessA, nil)
+		client := NewClient(sessB, codec.JSONCodec{})
+		defer client.Close()
+
+		go client.Call(ctx, "", nil)
+		<-started
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		n, err := srv.Shutdown(ctx)
+		if n != 1 || err != context.DeadlineExceeded {
+			t.Fatalf("unexpected shutdown result: %d %v", n, err)
+		}
+	})
+
+	t.Run("serve returns", func(t *testing.T) {
+		l, err := mux.ListenTCP("127.0.0.1:0")
+		fatal(t, err)
+		srv := &Server{Codec: codec.JSONCodec{}}
+		served := make(chan error, 1)
+		go func() {
+			served <- srv.ServeMux(l)
+		}()
+
+		sess, err := mux.DialTCP(l.Addr().String())
+		fatal(t, err)
+		defer sess.Close()
+		client := NewClient(sess, codec.JSONCodec{})
+		_, err = client.Call(ctx, "missing", nil)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found error: %v", err)
+		}
+
+		_, err = srv.Shutdown(ctx)
+		fatal(t, err)
+		if err := <-served; err != ErrServerClosed {
+			t.Fatalf("unexpected serve error: %v", err)
+		}
+		if err := srv.ServeMux(l); err != ErrServerClosed {
+			t.Fatalf("unexpected serve error after shutdown: %v", err)
+		}
+	})
+}
+
+func pipeSessions() (a, b mux.Session) {
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	a, _ = mux.DialIO(aw, ar)
+	b, _ = mux.DialIO(bw, br)
+	return
+}
+
+type errSession struct {
+	mux.Session
+	err error
+}
+
+func (s errSession) Accept() (mux.Channel, error) {
+	return nil, s.err
+}
+
+func (s errSession) Close() error {
+	return nil
+}
+
+func TestServerAcceptError(t *testing.T) {
+	errAccept := errors.New("accept failed")
+	srv := &Server{Codec: codec.JSONCodec{}}
+	if err := srv.Respond(errSession{err: errAccept}, nil); err != errAccept {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package talk
 
 import (
 	"fmt"
+	"os/exec"
+	"runtime"
 
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
@@ -22,12 +24,26 @@ func init() {
 		"stdio": func(_ string) (mux.Session, error) {
 			return mux.DialStdio()
 		},
+		"cmd": func(cmdline string) (mux.Session, error) {
+			return mux.DialCommand(shellCommand(cmdline))
+		},
+	}
+}
+
+// shellCommand returns a command that runs cmdline with the system shell.
+func shellCommand(cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmdline)
 	}
+	return exec.Command("sh", "-c", cmdline)
 }
 
 // Dial connects to a remote address using a registered transport and returns a Peer.
-// Available transports are "tcp", "unix", "ws", and "stdio". In the case of "stdio",
-// the addr can be left an empty string.
+// Available transports are "tcp", "unix", "ws", "stdio", and "cmd". In the case of "stdio",
+// the addr can be left an empty string. In the case of "cmd", the addr is a command line
+// run with the system shell as a subprocess, using its stdio as the transport.
+// The Peer can't be used once its session ends, see DialPersistent for one that
+// connects again.
 func Dial(transport, addr string, codec codec.Codec) (*Peer, error) {
 	d, ok := Dialers[transport]
 	if !ok {
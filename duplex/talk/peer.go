@@ -1,6 +1,8 @@
 package talk
 
 import (
+	"context"
+
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
 	"tractor.dev/toolkit-go/duplex/rpc"
@@ -13,18 +15,28 @@ type Peer struct {
 	*rpc.Server
 	*rpc.RespondMux
 	codec.Codec
+
+	refs refs
 }
 
 // NewPeer returns a Peer based on a session and codec.
+//
+// Objects returned by its handlers are exported and sent to the remote
+// Peer as a Ref, so it can call them with a Remote. Objects are values
+// that are rpc.Handlers, and pointers to structs with methods but no
+// exported fields that don't encode themselves and aren't errors, which
+// would otherwise be sent as empty values. See Export.
 func NewPeer(session mux.Session, codec codec.Codec) *Peer {
 	mux := rpc.NewRespondMux()
-	return &Peer{
+	p := &Peer{
 		Session:    session,
 		Codec:      codec,
 		Client:     rpc.NewClient(session, codec),
 		Server:     &rpc.Server{Handler: mux, Codec: codec},
 		RespondMux: mux,
 	}
+	mux.Use(p.exportReturns)
+	return p
 }
 
 // Close will close the underlying session.
@@ -33,7 +45,15 @@ func (p *Peer) Close() error {
 }
 
 // Respond lets the Peer respond to incoming channels like
-// a server, using any registered handlers.
-func (p *Peer) Respond() {
-	p.Server.Respond(p.Session, nil)
+// a server, using any registered handlers. It returns when
+// the session is closed, with the error from rpc.Server.Respond.
+func (p *Peer) Respond() error {
+	return p.Server.Respond(p.Session, nil)
+}
+
+// Authenticate authenticates the session with the remote Peer using
+// creds, which must match the Authenticator set on its Server. See
+// rpc.Authenticate.
+func (p *Peer) Authenticate(ctx context.Context, creds rpc.Credentials) error {
+	return rpc.Authenticate(ctx, p.Client, creds)
 }
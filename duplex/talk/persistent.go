@@ -0,0 +1,296 @@
+package talk
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// ConnState is the connection state of a PersistentPeer.
+type ConnState int
+
+const (
+	// Connecting is the state while dialing and running the OnConnect hook.
+	Connecting ConnState = iota
+	// Connected is the state while there is a session to make calls over.
+	Connected
+	// Disconnected is the state after a session ends or fails to connect,
+	// while waiting to connect again.
+	Disconnected
+	// Closed is the state after Close, which is final.
+	Closed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	case Closed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+// PendingPolicy is what a PersistentPeer does with calls made while it is not connected.
+type PendingPolicy int
+
+const (
+	// FailPending fails calls with rpc.ErrUnavailable.
+	FailPending PendingPolicy = iota
+	// QueuePending makes calls wait until connected, or until their context is done.
+	QueuePending
+)
+
+// PersistentConfig configures a PersistentPeer. Zero fields use the defaults.
+type PersistentConfig struct {
+	// OnConnect is called with the Peer for each new session before calls are
+	// made over it, for things like authenticating or subscribing again. If it
+	// returns an error, the session is closed and connecting is tried again.
+	OnConnect func(peer *Peer) error
+
+	// OnStateChange is called with each change of state, in order, along with
+	// the error that caused it when disconnected.
+	OnStateChange func(state ConnState, err error)
+
+	// Pending is what to do with calls made while not connected. Defaults to FailPending.
+	Pending PendingPolicy
+
+	// InitialBackoff is the most to wait before the first attempt to connect again,
+	// and MaxBackoff the most to wait before any. The limit doubles after each
+	// failed attempt and the wait is chosen at random below it. They default to
+	// 100ms and 30s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// PersistentPeer is a Peer that connects again whenever its session ends, until it
+// is closed. Handlers registered on its RespondMux are used for every session, and
+// calls are made over the current session.
+type PersistentPeer struct {
+	*rpc.RespondMux
+
+	dial   func() (mux.Session, error)
+	codec  codec.Codec
+	config PersistentConfig
+
+	mu        sync.Mutex
+	peer      *Peer
+	state     ConnState
+	ready     chan struct{} // closed when connected or closed
+	done      chan struct{}
+	changes   []stateChange // waiting to be passed to OnStateChange
+	notifying bool
+}
+
+type stateChange struct {
+	state ConnState
+	err   error
+}
+
+// DialPersistent returns a PersistentPeer that connects to addr using a registered
+// transport, as done by Dial. It connects in the background, so it only returns an
+// error if the transport is not registered.
+func DialPersistent(transport, addr string, codec codec.Codec, config PersistentConfig) (*PersistentPeer, error) {
+	d, ok := Dialers[transport]
+	if !ok {
+		return nil, fmt.Errorf("transport '%s' not in available in Dialers", transport)
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = 100 * time.Millisecond
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	p := &PersistentPeer{
+		RespondMux: rpc.NewRespondMux(),
+		dial:       func() (mux.Session, error) { return d(addr) },
+		codec:      codec,
+		config:     config,
+		ready:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// State returns the current connection state.
+func (p *PersistentPeer) State() ConnState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Peer returns the Peer for the current session, or nil if not connected.
+func (p *PersistentPeer) Peer() *Peer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peer
+}
+
+// Call makes a call over the current session. If not connected, the call fails with
+// rpc.ErrUnavailable or waits to be connected, depending on the Pending policy. Calls
+// are not made again if the session ends before they return.
+func (p *PersistentPeer) Call(ctx context.Context, selector string, args any, reply ...any) (*rpc.Response, error) {
+	for {
+		p.mu.Lock()
+		peer, state, ready := p.peer, p.state, p.ready
+		p.mu.Unlock()
+		switch {
+		case state == Closed:
+			return nil, fmt.Errorf("%w: talk: peer closed", rpc.ErrUnavailable)
+		case peer != nil:
+			return peer.Call(ctx, selector, args, reply...)
+		case p.config.Pending == FailPending:
+			return nil, fmt.Errorf("%w: talk: peer %s", rpc.ErrUnavailable, state)
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops connecting and closes the current session. Waiting calls fail.
+func (p *PersistentPeer) Close() error {
+	p.mu.Lock()
+	if p.state == Closed {
+		p.mu.Unlock()
+		return nil
+	}
+	peer := p.peer
+	p.state, p.peer = Closed, nil
+	close(p.done)
+	select {
+	case <-p.ready:
+	default:
+		close(p.ready)
+	}
+	p.notify(Closed, nil)
+
+	if peer != nil {
+		return peer.Close()
+	}
+	return nil
+}
+
+// run connects until closed, waiting with backoff between attempts.
+func (p *PersistentPeer) run() {
+	limit := p.config.InitialBackoff
+	for {
+		if !p.setState(Connecting, nil, nil) {
+			return
+		}
+		connected, err := p.connect()
+		if connected {
+			limit = p.config.InitialBackoff
+		}
+		if !p.setState(Disconnected, nil, err) {
+			return
+		}
+		t := time.NewTimer(time.Duration(rand.Int63n(int64(limit) + 1)))
+		select {
+		case <-p.done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		limit = min(limit*2, p.config.MaxBackoff)
+	}
+}
+
+// connect dials a session and uses it until it ends, reporting whether it was
+// connected, and returning the error that ended or failed the session.
+func (p *PersistentPeer) connect() (bool, error) {
+	sess, err := p.dial()
+	if err != nil {
+		return false, err
+	}
+	peer := p.newPeer(sess)
+	go peer.Respond()
+	if p.config.OnConnect != nil {
+		if err := p.config.OnConnect(peer); err != nil {
+			peer.Close()
+			return false, err
+		}
+	}
+	if !p.setState(Connected, peer, nil) {
+		peer.Close()
+		return false, nil
+	}
+	return true, sess.Wait()
+}
+
+// newPeer returns a Peer for sess with its own RespondMux, for objects it exports,
+// that falls back to the handlers of the PersistentPeer.
+func (p *PersistentPeer) newPeer(sess mux.Session) *Peer {
+	m := rpc.NewRespondMux()
+	m.Handle("/", p.RespondMux)
+	peer := &Peer{
+		Session:    sess,
+		Codec:      p.codec,
+		Client:     rpc.NewClient(sess, p.codec),
+		Server:     &rpc.Server{Handler: m, Codec: p.codec},
+		RespondMux: m,
+	}
+	m.Use(peer.exportReturns)
+	return peer
+}
+
+// setState sets the state and the peer for it, notifying waiting calls and
+// OnStateChange. It returns false if the PersistentPeer is closed.
+func (p *PersistentPeer) setState(state ConnState, peer *Peer, err error) bool {
+	p.mu.Lock()
+	if p.state == Closed {
+		p.mu.Unlock()
+		return false
+	}
+	p.state, p.peer = state, peer
+	if state == Connected {
+		close(p.ready)
+	} else {
+		select {
+		case <-p.ready:
+			p.ready = make(chan struct{})
+		default:
+		}
+	}
+	p.notify(state, err)
+	return true
+}
+
+// notify queues a change for OnStateChange and unlocks mu. Changes are passed
+// in order by whichever call finds none being passed, with no locks held, so
+// OnStateChange can use the PersistentPeer, including calling Close.
+func (p *PersistentPeer) notify(state ConnState, err error) {
+	if p.config.OnStateChange == nil {
+		p.mu.Unlock()
+		return
+	}
+	p.changes = append(p.changes, stateChange{state, err})
+	if p.notifying {
+		p.mu.Unlock()
+		return
+	}
+	p.notifying = true
+	for len(p.changes) > 0 {
+		c := p.changes[0]
+		p.changes = p.changes[1:]
+		p.mu.Unlock()
+		p.config.OnStateChange(c.state, c.err)
+		p.mu.Lock()
+	}
+	p.notifying = false
+	p.mu.Unlock()
+}
@@ -0,0 +1,253 @@
+package talk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/fn"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+// testBackend is a server that can be taken down and brought back up.
+type testBackend struct {
+	mu     sync.Mutex
+	up     bool
+	server *Peer
+}
+
+func (b *testBackend) dial(addr string) (mux.Session, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.up {
+		return nil, errors.New("connection refused")
+	}
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	sessA, _ := mux.DialIO(aw, ar)
+	sessB, _ := mux.DialIO(bw, br)
+	b.server = NewPeer(sessA, codec.JSONCodec{})
+	b.server.Handle("echo", fn.HandlerFrom(func(s string) string {
+		return s
+	}))
+	go b.server.Respond()
+	return sessB, nil
+}
+
+func (b *testBackend) setUp(up bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.up = up
+	if !up && b.server != nil {
+		b.server.Close()
+		b.server = nil
+	}
+}
+
+func (b *testBackend) peer() *Peer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.server
+}
+
+// stateLog records the states passed to OnStateChange.
+type stateLog struct {
+	mu     sync.Mutex
+	states []ConnState
+}
+
+func (l *stateLog) record(state ConnState, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.states = append(l.states, state)
+}
+
+func (l *stateLog) count(state ConnState) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var n int
+	for _, s := range l.states {
+		if s == state {
+			n++
+		}
+	}
+	return n
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPersistentPeer(t *testing.T) {
+	ctx := context.Background()
+	backend := &testBackend{up: true}
+	Dialers["test"] = backend.dial
+	defer delete(Dialers, "test")
+
+	t.Run("reconnect", func(t *testing.T) {
+		var log stateLog
+		var mu sync.Mutex
+		var connects int
+		peer, err := DialPersistent("test", "", codec.JSONCodec{}, PersistentConfig{
+			OnConnect: func(p *Peer) error {
+				mu.Lock()
+				defer mu.Unlock()
+				connects++
+				if connects == 2 {
+					return errors.New("auth failed")
+				}
+				// calls can be made before others are let through
+				_, err := p.Call(ctx, "echo", fn.Args{"hello"})
+				return err
+			},
+			OnStateChange:  log.record,
+			InitialBackoff: 5 * time.Millisecond,
+			MaxBackoff:     20 * time.Millisecond,
+		})
+		fatal(t, err)
+		defer peer.Close()
+		peer.Handle("name", fn.HandlerFrom(func() string {
+			return "agent"
+		}))
+
+		waitFor(t, "connect", func() bool { return peer.State() == Connected })
+		var s string
+		_, err = peer.Call(ctx, "echo", fn.Args{"one"}, &s)
+		fatal(t, err)
+		if s != "one" {
+			t.Fatalf("unexpected echo: %v", s)
+		}
+		_, err = backend.peer().Call(ctx, "name", nil, &s)
+		fatal(t, err)
+		if s != "agent" {
+			t.Fatalf("unexpected name: %v", s)
+		}
+
+		backend.setUp(false)
+		waitFor(t, "disconnect", func() bool { return peer.State() != Connected })
+		_, err = peer.Call(ctx, "echo", fn.Args{"two"})
+		if !errors.Is(err, rpc.ErrUnavailable) {
+			t.Fatalf("expected unavailable error, got: %v", err)
+		}
+
+		backend.setUp(true)
+		waitFor(t, "reconnect", func() bool { return peer.State() == Connected })
+		_, err = peer.Call(ctx, "echo", fn.Args{"three"}, &s)
+		fatal(t, err)
+		if s != "three" {
+			t.Fatalf("unexpected echo: %v", s)
+		}
+		_, err = backend.peer().Call(ctx, "name", nil, &s)
+		fatal(t, err)
+
+		mu.Lock()
+		if connects != 3 {
+			t.Fatalf("expected OnConnect to be called 3 times, got %d", connects)
+		}
+		mu.Unlock()
+		if n := log.count(Connected); n != 2 {
+			t.Fatalf("expected to be connected twice, got %d", n)
+		}
+
+		fatal(t, peer.Close())
+		if peer.State() != Closed {
+			t.Fatal("expected closed state")
+		}
+		waitFor(t, "closed state change", func() bool { return log.count(Closed) == 1 })
+		_, err = peer.Call(ctx, "echo", fn.Args{"four"})
+		if !errors.Is(err, rpc.ErrUnavailable) {
+			t.Fatalf("expected unavailable error, got: %v", err)
+		}
+	})
+
+	t.Run("queue pending", func(t *testing.T) {
+		backend.setUp(false)
+		peer, err := DialPersistent("test", "", codec.JSONCodec{}, PersistentConfig{
+			Pending:        QueuePending,
+			InitialBackoff: 5 * time.Millisecond,
+			MaxBackoff:     20 * time.Millisecond,
+		})
+		fatal(t, err)
+		defer peer.Close()
+
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := peer.Call(timeout, "echo", fn.Args{"one"}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got: %v", err)
+		}
+
+		result := make(chan error, 1)
+		go func() {
+			var s string
+			_, err := peer.Call(ctx, "echo", fn.Args{"two"}, &s)
+			if err == nil && s != "two" {
+				err = errors.New("unexpected echo: " + s)
+			}
+			result <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		backend.setUp(true)
+		fatal(t, <-result)
+
+		backend.setUp(false)
+		waitFor(t, "disconnect", func() bool { return peer.State() != Connected })
+		go func() {
+			_, err := peer.Call(ctx, "echo", fn.Args{"three"})
+			result <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		peer.Close()
+		if err := <-result; !errors.Is(err, rpc.ErrUnavailable) {
+			t.Fatalf("expected unavailable error, got: %v", err)
+		}
+	})
+
+	t.Run("close on state change", func(t *testing.T) {
+		backend.setUp(false)
+		var log stateLog
+		var peer *PersistentPeer
+		created := make(chan struct{})
+		closed := make(chan error, 1)
+		peer, err := DialPersistent("test", "", codec.JSONCodec{}, PersistentConfig{
+			OnStateChange: func(state ConnState, err error) {
+				log.record(state, err)
+				if state == Disconnected {
+					<-created
+					peer.State()
+					closed <- peer.Close()
+				}
+			},
+			InitialBackoff: 5 * time.Millisecond,
+		})
+		fatal(t, err)
+		close(created)
+		select {
+		case err := <-closed:
+			fatal(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out closing from OnStateChange")
+		}
+		waitFor(t, "closed state change", func() bool { return log.count(Closed) == 1 })
+		if peer.State() != Closed || log.count(Disconnected) != 1 {
+			t.Fatal("expected to close after first disconnect")
+		}
+	})
+
+	t.Run("unknown transport", func(t *testing.T) {
+		if _, err := DialPersistent("missing", "", codec.JSONCodec{}, PersistentConfig{}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package talk
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"tractor.dev/toolkit-go/duplex/fn"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+const (
+	// RefPrefix is the selector prefix exported objects are registered under.
+	RefPrefix = "duplex.ref"
+
+	// ReleaseSelector is the selector used to release an exported object.
+	ReleaseSelector = "duplex.release"
+)
+
+// Ref is a reference to an object exported by a Peer, which can be sent
+// to the remote Peer in place of the object. The remote Peer makes calls
+// to the object with a Remote for the Ref.
+type Ref struct {
+	ID string
+}
+
+// Selector returns the selector prefix of the object referenced by r.
+func (r Ref) Selector() string {
+	return RefPrefix + "." + r.ID
+}
+
+// refs tracks the objects exported by a Peer.
+type refs struct {
+	mu      sync.Mutex
+	ids     map[string]bool
+	started bool
+}
+
+// Export registers v as an object the remote Peer can call, under a random
+// selector that can't be guessed, and returns a Ref for it to send to the
+// remote Peer. If v is an rpc.Handler it is used as is, otherwise v is made
+// into one with fn.HandlerFrom. Handlers can also return objects, which are
+// exported and sent as a Ref, as described by NewPeer:
+//
+//	peer.Handle("open", fn.HandlerFrom(func(name string) (*File, error) {
+//		return openFile(name)
+//	}))
+//
+// The object stays registered until the remote Peer releases it, which
+// happens when its Remote is released or garbage collected, or until
+// the session ends.
+func (p *Peer) Export(v any) (Ref, error) {
+	h, ok := v.(rpc.Handler)
+	if !ok {
+		h = fn.HandlerFrom(v)
+	}
+
+	p.refs.mu.Lock()
+	if !p.refs.started {
+		p.refs.started = true
+		p.refs.ids = make(map[string]bool)
+		p.RespondMux.Handle(ReleaseSelector, rpc.HandlerFunc(p.respondRelease))
+		go func() {
+			p.Session.Wait()
+			p.releaseAll()
+		}()
+	}
+	var ref Ref
+	for ref.ID == "" || p.refs.ids[ref.ID] {
+		id, err := fn.NewID()
+		if err != nil {
+			p.refs.mu.Unlock()
+			return Ref{}, err
+		}
+		ref.ID = id
+	}
+	p.refs.ids[ref.ID] = true
+	p.refs.mu.Unlock()
+
+	p.RespondMux.Handle(ref.Selector(), h)
+	return ref, nil
+}
+
+// exportReturns is middleware sending the objects handlers return as Refs.
+func (p *Peer) exportReturns(h rpc.Handler) rpc.Handler {
+	return rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		h.RespondRPC(&exportResponder{Responder: r, peer: p}, c)
+	})
+}
+
+// exportResponder exports the objects in values it responds with.
+type exportResponder struct {
+	rpc.Responder
+	peer *Peer
+}
+
+func (r *exportResponder) Unwrap() rpc.Responder {
+	return r.Responder
+}
+
+func (r *exportResponder) Return(v ...any) error {
+	v, err := r.export(v)
+	if err != nil {
+		return r.Responder.Return(err)
+	}
+	return r.Responder.Return(v...)
+}
+
+func (r *exportResponder) Continue(v ...any) (mux.Channel, error) {
+	v, err := r.export(v)
+	if err != nil {
+		// respond with the error, leaving the channel closed
+		ch, _ := r.Responder.Continue(err)
+		if ch != nil {
+			ch.Close()
+		}
+		return ch, err
+	}
+	return r.Responder.Continue(v...)
+}
+
+// export returns v with the objects in it replaced by Refs for them.
+func (r *exportResponder) export(v []any) ([]any, error) {
+	var copied bool
+	for i, vv := range v {
+		if !isObject(vv) {
+			continue
+		}
+		if !copied {
+			v = append([]any(nil), v...)
+			copied = true
+		}
+		ref, err := r.peer.Export(vv)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = ref
+	}
+	return v, nil
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+)
+
+// isObject reports whether v is returned by reference, which is when it is an
+// rpc.Handler, or a pointer to a struct with methods but no exported fields, so
+// would be sent as an empty value, unless it encodes itself or is an error.
+func isObject(v any) bool {
+	switch v.(type) {
+	case rpc.Handler:
+		return true
+	case error:
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	t := rv.Type()
+	if t.NumMethod() == 0 || t.Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || t.Implements(binaryMarshalerType) {
+		return false
+	}
+	for _, f := range reflect.VisibleFields(t.Elem()) {
+		if f.IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Peer) respondRelease(r rpc.Responder, c *rpc.Call) {
+	var ref Ref
+	if err := c.Receive(&ref); err != nil {
+		r.Return(err)
+		return
+	}
+	if !p.release(ref) {
+		r.Return(fmt.Errorf("%w: %s", rpc.ErrNotFound, ref.Selector()))
+		return
+	}
+	r.Return()
+}
+
+// release unregisters the object exported for ref, reporting whether there was one.
+func (p *Peer) release(ref Ref) bool {
+	p.refs.mu.Lock()
+	defer p.refs.mu.Unlock()
+	if !p.refs.ids[ref.ID] {
+		return false
+	}
+	delete(p.refs.ids, ref.ID)
+	// handlers that are sub muxes are registered with a trailing slash
+	p.RespondMux.Remove(ref.Selector())
+	p.RespondMux.Remove(ref.Selector() + "/")
+	return true
+}
+
+func (p *Peer) releaseAll() {
+	p.refs.mu.Lock()
+	ids := make([]string, 0, len(p.refs.ids))
+	for id := range p.refs.ids {
+		ids = append(ids, id)
+	}
+	p.refs.mu.Unlock()
+	for _, id := range ids {
+		p.release(Ref{ID: id})
+	}
+}
+
+// Remote makes calls to an object exported by the remote Peer. It implements
+// rpc.Caller with selectors relative to the object, so it can be used with
+// fn.ClientFor. A selector of "" calls the object itself, for objects that
+// are single handlers.
+type Remote struct {
+	peer *Peer
+	ref  Ref
+	once sync.Once
+	err  error
+}
+
+// Remote returns a Remote for an object exported by the remote Peer.
+// The object is released when the Remote is released or garbage collected.
+func (p *Peer) Remote(ref Ref) *Remote {
+	r := &Remote{peer: p, ref: ref}
+	runtime.SetFinalizer(r, func(r *Remote) {
+		go r.Release()
+	})
+	return r
+}
+
+// Ref returns the Ref of the object.
+func (r *Remote) Ref() Ref {
+	return r.ref
+}
+
+// Call calls selector on the object.
+func (r *Remote) Call(ctx context.Context, selector string, args any, reply ...any) (*rpc.Response, error) {
+	sel := r.ref.Selector()
+	if selector != "" {
+		sel += "." + selector
+	}
+	return r.peer.Call(ctx, sel, args, reply...)
+}
+
+// Release releases the object on the remote Peer, after which calls to it
+// fail with rpc.ErrNotFound. Only the first call releases the object, later
+// calls return the same result.
+func (r *Remote) Release() error {
+	r.once.Do(func() {
+		runtime.SetFinalizer(r, nil)
+		_, r.err = r.peer.Call(context.Background(), ReleaseSelector, r.ref)
+	})
+	return r.err
+}
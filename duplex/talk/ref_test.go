@@ -0,0 +1,209 @@
+package talk
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"tractor.dev/toolkit-go/duplex/codec"
+	"tractor.dev/toolkit-go/duplex/fn"
+	"tractor.dev/toolkit-go/duplex/mux"
+	"tractor.dev/toolkit-go/duplex/rpc"
+)
+
+type counter struct {
+	name  string
+	count int
+}
+
+func (c *counter) Name() string {
+	return c.name
+}
+
+func (c *counter) Incr(n int) int {
+	c.count += n
+	return c.count
+}
+
+func newPeerPair(t *testing.T) (*Peer, *Peer) {
+	sessA, sessB := mux.Pair()
+	peerA := NewPeer(sessA, codec.CBORCodec{})
+	peerB := NewPeer(sessB, codec.CBORCodec{})
+	go peerA.Respond()
+	go peerB.Respond()
+	t.Cleanup(func() {
+		peerA.Close()
+		peerB.Close()
+	})
+	return peerA, peerB
+}
+
+func hasRefs(p *Peer) bool {
+	for _, info := range p.Selectors() {
+		if strings.HasPrefix(info.Selector, RefPrefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRefs(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("export and release", func(t *testing.T) {
+		peerA, peerB := newPeerPair(t)
+		peerA.Handle("open", fn.HandlerFrom(func(name string) *counter {
+			return &counter{name: name}
+		}))
+
+		var ref Ref
+		_, err := peerB.Call(ctx, "open", fn.Args{"a"}, &ref)
+		fatal(t, err)
+		if len(ref.ID) != 16 {
+			t.Fatalf("expected random ref ID, got: %q", ref.ID)
+		}
+		remote := peerB.Remote(ref)
+
+		var name string
+		_, err = remote.Call(ctx, "Name", fn.Args{}, &name)
+		fatal(t, err)
+		if name != "a" {
+			t.Fatalf("unexpected name: %v", name)
+		}
+
+		c := fn.ClientFor[struct {
+			Incr func(n int) (int, error)
+		}](remote, "")
+		c.Incr(2)
+		n, err := c.Incr(3)
+		fatal(t, err)
+		if n != 5 {
+			t.Fatalf("unexpected count: %v", n)
+		}
+
+		fatal(t, remote.Release())
+		fatal(t, remote.Release())
+		if hasRefs(peerA) {
+			t.Fatal("expected object to be released")
+		}
+		_, err = remote.Call(ctx, "Name", fn.Args{}, &name)
+		if !errors.Is(err, rpc.ErrNotFound) {
+			t.Fatalf("expected not found error, got: %v", err)
+		}
+	})
+
+	t.Run("returned handlers", func(t *testing.T) {
+		peerA, peerB := newPeerPair(t)
+		peerA.Handle("echo", fn.HandlerFrom(func() rpc.Handler {
+			return rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+				var s string
+				c.Receive(&s)
+				r.Return(s)
+			})
+		}))
+
+		var ref Ref
+		_, err := peerB.Call(ctx, "echo", nil, &ref)
+		fatal(t, err)
+		remote := peerB.Remote(ref)
+		defer remote.Release()
+
+		var s string
+		_, err = remote.Call(ctx, "", "hello", &s)
+		fatal(t, err)
+		if s != "hello" {
+			t.Fatalf("unexpected reply: %v", s)
+		}
+	})
+
+	t.Run("returned values", func(t *testing.T) {
+		peerA, peerB := newPeerPair(t)
+		type user struct {
+			Name string
+		}
+		peerA.Handle("user", fn.HandlerFrom(func() (*user, time.Time) {
+			return &user{Name: "a"}, time.Unix(0, 0).UTC()
+		}))
+
+		var u user
+		var ts time.Time
+		_, err := peerB.Call(ctx, "user", nil, &u, &ts)
+		fatal(t, err)
+		if u.Name != "a" || !ts.Equal(time.Unix(0, 0)) {
+			t.Fatalf("unexpected values: %v %v", u, ts)
+		}
+		if hasRefs(peerA) {
+			t.Fatal("expected values not to be exported")
+		}
+	})
+
+	t.Run("capability passing", func(t *testing.T) {
+		peerA, peerB := newPeerPair(t)
+		peerA.Handle("subscribe", fn.HandlerFrom(func(ctx context.Context, ref Ref) error {
+			callback := peerA.Remote(ref)
+			defer callback.Release()
+			_, err := callback.Call(ctx, "", "event")
+			return err
+		}))
+
+		events := make(chan string, 1)
+		ref, err := peerB.Export(rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+			var event string
+			c.Receive(&event)
+			events <- event
+			r.Return()
+		}))
+		fatal(t, err)
+		_, err = peerB.Call(ctx, "subscribe", fn.Args{ref})
+		fatal(t, err)
+		if e := <-events; e != "event" {
+			t.Fatalf("unexpected event: %v", e)
+		}
+		if hasRefs(peerB) {
+			t.Fatal("expected callback to be released")
+		}
+	})
+
+	t.Run("released when dropped", func(t *testing.T) {
+		peerA, peerB := newPeerPair(t)
+		ref, err := peerA.Export(&counter{})
+		fatal(t, err)
+		peerB.Remote(ref)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for hasRefs(peerA) {
+			if time.Now().After(deadline) {
+				t.Fatal("expected dropped remote to release object")
+			}
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("released on session end", func(t *testing.T) {
+		peerA, peerB := newPeerPair(t)
+		_, err := peerA.Export(&counter{})
+		fatal(t, err)
+		_, err = peerA.Export(&counter{})
+		fatal(t, err)
+		peerB.Close()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for hasRefs(peerA) {
+			if time.Now().After(deadline) {
+				t.Fatal("expected session end to release objects")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func fatal(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}